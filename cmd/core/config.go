@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+
+	"emperror.dev/errors"
+	"github.com/BurntSushi/toml"
+	"github.com/je4/securedisplay/config"
+	"github.com/je4/securedisplay/pkg/core"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/stashconfig"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+var name = flag.String("name", "", "name of the core client")
+var proxy = flag.String("proxy", "", "address of the websocket proxy server")
+var addr = flag.String("addr", "", "http address of the dashboard and api")
+var webFolder = flag.String("web", "", "web folder to serve the dashboard from")
+var configPath = flag.String("config", "", "path to config file")
+
+type APIConfig struct {
+	// Commands are the event types operators may send to displays and groups
+	Commands []event.EventType `toml:"commands"`
+	// Operators may send commands and emergencies, without operators all of them are rejected
+	Operators []*core.Operator `toml:"operator"`
+}
+
+type CoreConfig struct {
+	ProxyAddr string             `toml:"proxy"`
+	Name      string             `toml:"name"`
+	LocalAddr string             `toml:"localaddr"`
+	WebFolder string             `toml:"web_folder"`
+	TLS       bool               `toml:"tls"`
+	API       APIConfig          `toml:"api"`
+	ClientTLS loader.Config      `toml:"clienttls"`
+	ServerTLS loader.Config      `toml:"servertls"`
+	Log       stashconfig.Config `toml:"log"`
+}
+
+func loadConfig() (*CoreConfig, error) {
+	flag.Parse()
+	cfg := &CoreConfig{}
+	// fill the default values
+	if _, err := toml.Decode(string(config.CoreToml), cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to load default config from")
+	}
+	if *configPath != "" {
+		// enhance it with the external file
+		if _, err := toml.DecodeFile(*configPath, cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to load config from %s", *configPath)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			cfg.Name = *name
+		case "proxy":
+			cfg.ProxyAddr = *proxy
+		case "addr":
+			cfg.LocalAddr = *addr
+		case "web":
+			cfg.WebFolder = *webFolder
+		}
+	})
+
+	return cfg, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/data"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/core"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/trustutil/v2/pkg/certutil"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+func main() {
+
+	conf, err := loadConfig()
+	if err != nil {
+		panic(fmt.Sprintf("Error loading config: %v", err))
+	}
+	var loggerTLSConfig *tls.Config
+	var loggerLoader io.Closer
+	if conf.Log.Stash.TLS != nil {
+		loggerTLSConfig, loggerLoader, err = loader.CreateClientLoader(conf.Log.Stash.TLS, nil)
+		if err != nil {
+			log.Fatalf("cannot create stash client loader: %v", err)
+		}
+		defer loggerLoader.Close()
+	}
+
+	_logger, _logstash, _logfile, err := ublogger.CreateUbMultiLoggerTLS(conf.Log.Level, conf.Log.File,
+		ublogger.SetDataset(conf.Log.Stash.Dataset),
+		ublogger.SetLogStash(conf.Log.Stash.LogstashHost, conf.Log.Stash.LogstashPort, conf.Log.Stash.Namespace, conf.Log.Stash.LogstashTraceLevel),
+		ublogger.SetTLS(conf.Log.Stash.TLS != nil),
+		ublogger.SetTLSConfig(loggerTLSConfig),
+	)
+	if err != nil {
+		log.Fatalf("cannot create logger: %v", err)
+	}
+	if _logstash != nil {
+		defer _logstash.Close()
+	}
+	if _logfile != nil {
+		defer _logfile.Close()
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("cannot get hostname: %v", err)
+	}
+	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
+	var logger zLogger.ZLogger = &l2
+
+	certutil.AddDefaultDNSNames("ws:" + conf.Name)
+	clientTLSConfig, clientLoader, err := loader.CreateClientLoader(&conf.ClientTLS, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot create client loader")
+	}
+	defer clientLoader.Close()
+	ca, err := clientLoader.GetCA()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot get CA")
+	}
+	clientTLSConfig.RootCAs = ca
+
+	wsPath, err := url.JoinPath(conf.ProxyAddr, conf.Name)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create websocket path")
+		return
+	}
+	logger.Info().Msgf("Connecting to websocket proxy server at %s", wsPath)
+
+	wsDialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  clientTLSConfig,
+	}
+	c, _, err := wsDialer.Dial(wsPath, nil)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to connect to websocket proxy server with %s", wsPath)
+		return
+	}
+	defer c.Close()
+
+	comm := client.NewCommunication(transport.NewWebsocket(c), conf.Name, logger)
+	coreService := core.NewCore(comm, logger)
+	coreService.Start()
+	if err := comm.Start(); err != nil {
+		logger.Error().Err(err).Msg("Failed to start communication")
+		return
+	}
+	defer func() {
+		logger.Info().Msg("Closing communication")
+		if err := comm.Stop(); err != nil {
+			logger.Error().Err(err).Msg("Failed to stop server")
+		}
+	}()
+	// all displays send their status to core
+	jsonBytes, err := json.Marshal("core")
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to marshal json")
+	}
+	if err := comm.Send(&event.Event{
+		Type:   event.TypeAttach,
+		Source: conf.Name,
+		Target: "",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to send event")
+	}
+
+	var webFS fs.FS = data.FS
+	if conf.WebFolder != "" {
+		webFS = os.DirFS(conf.WebFolder)
+	}
+	staticFS, err := fs.Sub(webFS, "static")
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create static file system")
+		return
+	}
+	templateFS, err := fs.Sub(webFS, "templates")
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create template file system")
+		return
+	}
+
+	var serverTLSConfig *tls.Config
+	if conf.TLS {
+		var serverLoader io.Closer
+		serverTLSConfig, serverLoader, err = loader.CreateServerLoader(false, &conf.ServerTLS, nil, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("cannot create server loader")
+		}
+		defer serverLoader.Close()
+		// operators may authenticate with a client certificate
+		serverTLSConfig.ClientCAs = ca
+		serverTLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	} else if slices.ContainsFunc(conf.API.Operators, func(op *core.Operator) bool { return op.Token != "" }) {
+		logger.Warn().Msg("operator tokens are sent over plain http, enable tls")
+	}
+	srv := core.NewServer(conf.LocalAddr, coreService, staticFS, templateFS, logger)
+	srv.SetOperators(conf.API.Operators)
+	srv.SetCommands(conf.API.Commands)
+	if err := srv.Start(serverTLSConfig); err != nil {
+		logger.Error().Err(err).Msg("Failed to start server")
+		return
+	}
+	defer func() {
+		if err := srv.Stop(); err != nil {
+			logger.Error().Err(err).Msg("Failed to stop server")
+		}
+	}()
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	<-sigint
+	logger.Info().Msg("Received shutdown signal")
+}
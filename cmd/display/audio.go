@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// systemAudio applies set-volume, mute and unmute to the system mixer, if a command is configured.
+// Otherwise the event is applied to the page.
+func (s *screen) systemAudio(t event.EventType, volume float64) (bool, error) {
+	s.confMu.Lock()
+	conf := s.conf
+	s.confMu.Unlock()
+	var args []string
+	switch t {
+	case event.TypeSetVolume:
+		percent := strconv.Itoa(int(volume*100 + 0.5))
+		for _, arg := range conf.Audio.VolumeCommand {
+			args = append(args, strings.ReplaceAll(arg, "{volume}", percent))
+		}
+	case event.TypeMute:
+		args = conf.Audio.MuteCommand
+	case event.TypeUnmute:
+		args = conf.Audio.UnmuteCommand
+	}
+	if len(args) == 0 {
+		return false, nil
+	}
+	if _, err := runCommand(conf, args, ""); err != nil {
+		return false, err
+	}
+	s.logger.Info().Msgf("%s applied to the system mixer", t)
+	return true, nil
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"flag"
+	"maps"
+	"slices"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/BurntSushi/toml"
 	"github.com/je4/securedisplay/config"
+	"github.com/je4/securedisplay/pkg/provision"
 	"github.com/je4/utils/v2/pkg/stashconfig"
 	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
 )
@@ -17,14 +21,213 @@ var configPath = flag.String("config", "", "path to config file")
 var playerURL = flag.String("player", "", "url of the player server")
 var noKiosk = flag.Bool("no-kiosk", false, "disable kiosk")
 
+type WatchdogConfig struct {
+	Enabled     bool          `toml:"enabled"`
+	Interval    time.Duration `toml:"interval"`
+	Deadline    time.Duration `toml:"deadline"`
+	MaxFailures int           `toml:"maxfailures"`
+}
+
+type ContentConfig struct {
+	// AllowedOrigins restricts content and navigation to these origins (scheme://host[:port]), empty allows all
+	AllowedOrigins []string `toml:"allowed_origins"`
+	// RequireSignature requires a manifest signed by one of the trusted keys for every content url
+	RequireSignature bool `toml:"require_signature"`
+	// TrustedKeys are base64 encoded ed25519 public keys
+	TrustedKeys []string `toml:"trusted_keys"`
+}
+
+type CacheConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Dir is the cache folder, empty uses the user cache dir
+	Dir string `toml:"dir"`
+	// MaxSize is the maximum size of the cache in MB
+	MaxSize int64 `toml:"max_size"`
+	// Addr of the local http server for the browser
+	Addr string `toml:"addr"`
+}
+
+type BrowserConfig struct {
+	// Flags are chrome command line flags, which override the defaults. false removes a flag.
+	Flags map[string]interface{} `toml:"flags"`
+	// Width and Height of the window in pixels, 0 uses the screen size
+	Width  int `toml:"width"`
+	Height int `toml:"height"`
+	// X and Y of the window on the virtual screen, selects the monitor on multi-monitor setups
+	X int `toml:"x"`
+	Y int `toml:"y"`
+	// Display is the X11 display chrome is started on (e.g. :0.1), empty uses $DISPLAY
+	Display string `toml:"display"`
+	// ExecPath is the chrome binary, empty searches the default locations
+	ExecPath string `toml:"exec_path"`
+	// UserDataDir keeps the chrome profile between starts, empty uses a temporary folder
+	UserDataDir string `toml:"user_data_dir"`
+	// Extensions are folders of unpacked extensions
+	Extensions []string `toml:"extensions"`
+}
+
+type ProvisionConfig struct {
+	// Enabled requests a certificate from the proxy, if the display is not provisioned yet.
+	// clienttls is the bootstrap credential.
+	Enabled bool `toml:"enabled"`
+	// Dir keeps the provisioned certificate and configuration, empty uses the user config folder
+	Dir string `toml:"dir"`
+	// PollInterval of the approval
+	PollInterval time.Duration `toml:"poll_interval"`
+}
+
+type HealthConfig struct {
+	// Enabled sends health events to the core
+	Enabled  bool          `toml:"enabled"`
+	Interval time.Duration `toml:"interval"`
+	// Disk is a path on the filesystem, whose free space is reported
+	Disk string `toml:"disk"`
+}
+
+type LogBufferConfig struct {
+	// Size is the number of log and browser console entries kept for get-logs events
+	Size int `toml:"size"`
+	// Senders are the clients allowed to send get-logs and log-stream, empty allows none
+	Senders []string `toml:"senders"`
+}
+
+type LifecycleConfig struct {
+	// Senders are the clients allowed to send reload, restart-browser, restart-display and screen-power, empty allows none
+	Senders []string `toml:"senders"`
+	// ExitCode of restart-display, the supervisor of the process starts it again
+	ExitCode int `toml:"exit_code"`
+	// PowerMethod of screen-power is dpms, cec or command, empty disables screen-power
+	PowerMethod string `toml:"power_method"`
+	// PowerOn and PowerOff are the commands with arguments of the power method command
+	PowerOn  []string `toml:"power_on"`
+	PowerOff []string `toml:"power_off"`
+}
+
+type AudioConfig struct {
+	// VolumeCommand sets the volume of the system mixer instead of the page, {volume} is replaced by the percentage
+	VolumeCommand []string `toml:"volume_command"`
+	// MuteCommand and UnmuteCommand mute the system mixer instead of the page
+	MuteCommand   []string `toml:"mute_command"`
+	UnmuteCommand []string `toml:"unmute_command"`
+}
+
+// ScreenConfig is one window of a multi-monitor display. Empty values are taken from the display.
+type ScreenConfig struct {
+	Name      string `toml:"name"`
+	PlayerURL string `toml:"player"`
+	// Browser overrides the non-empty values of the display browser section, flags are merged
+	Browser BrowserConfig `toml:"browser"`
+	// ClientTLS is the certificate identity of the screen, nil uses the display certificate
+	ClientTLS *loader.Config `toml:"clienttls"`
+}
+
 type DisplayConfig struct {
 	ProxyAddr string             `toml:"proxy"`
 	Name      string             `toml:"name"`
 	PlayerURL string             `toml:"player"`
 	Kiosk     bool               `toml:"kiosk"`
 	Debug     bool               `toml:"debug"`
+	Watchdog  WatchdogConfig     `toml:"watchdog"`
+	Content   ContentConfig      `toml:"content"`
+	Cache     CacheConfig        `toml:"cache"`
+	Browser   BrowserConfig      `toml:"browser"`
+	Screens   []ScreenConfig     `toml:"screens"`
+	Provision ProvisionConfig    `toml:"provision"`
+	Health    HealthConfig       `toml:"health"`
+	LogBuffer LogBufferConfig    `toml:"logbuffer"`
+	Lifecycle LifecycleConfig    `toml:"lifecycle"`
+	Audio     AudioConfig        `toml:"audio"`
 	ClientTLS loader.Config      `toml:"clienttls"`
 	Log       stashconfig.Config `toml:"log"`
+
+	// ReloadInterval is the interval to check the config file for changes, 0 reloads on SIGHUP only
+	ReloadInterval time.Duration `toml:"reload_interval"`
+	// Volume is the default volume of the player page (0.0 to 1.0)
+	Volume float64 `toml:"volume"`
+	// Groups are joined besides core, i.e. the schedules of these groups are played
+	Groups []string `toml:"groups"`
+	// SettingsDir keeps the settings of config-update events, empty uses the user config folder
+	SettingsDir string `toml:"settings_dir"`
+	// SettingsSenders are the clients allowed to send config-update events, empty allows none
+	SettingsSenders []string `toml:"settings_senders"`
+
+	// identity is the certificate of a provisioned display, it replaces the clienttls certificate
+	identity *provision.Identity
+}
+
+// merge returns b with the non-empty values of override
+func (b BrowserConfig) merge(override BrowserConfig) BrowserConfig {
+	flags := maps.Clone(b.Flags)
+	if flags == nil {
+		flags = map[string]interface{}{}
+	}
+	maps.Copy(flags, override.Flags)
+	b.Flags = flags
+	if override.Width != 0 {
+		b.Width = override.Width
+	}
+	if override.Height != 0 {
+		b.Height = override.Height
+	}
+	if override.X != 0 {
+		b.X = override.X
+	}
+	if override.Y != 0 {
+		b.Y = override.Y
+	}
+	if override.Display != "" {
+		b.Display = override.Display
+	}
+	if override.ExecPath != "" {
+		b.ExecPath = override.ExecPath
+	}
+	if override.UserDataDir != "" {
+		b.UserDataDir = override.UserDataDir
+	}
+	if len(override.Extensions) > 0 {
+		b.Extensions = override.Extensions
+	}
+	return b
+}
+
+// screenConfigs returns the configuration of every screen with the settings of config-update events.
+// Without screens the display is a single screen.
+func (cfg *DisplayConfig) screenConfigs() ([]*DisplayConfig, error) {
+	var result = []*DisplayConfig{}
+	if len(cfg.Screens) == 0 {
+		result = append(result, cfg)
+	}
+	for i, sc := range cfg.Screens {
+		if sc.Name == "" {
+			return nil, errors.Errorf("screen #%d has no name", i)
+		}
+		if slices.ContainsFunc(result, func(c *DisplayConfig) bool { return c.Name == sc.Name }) {
+			return nil, errors.Errorf("duplicate screen name %s", sc.Name)
+		}
+		screenCfg := *cfg
+		screenCfg.Screens = nil
+		screenCfg.Name = sc.Name
+		if sc.PlayerURL != "" {
+			screenCfg.PlayerURL = sc.PlayerURL
+		}
+		screenCfg.Browser = cfg.Browser.merge(sc.Browser)
+		if sc.ClientTLS != nil {
+			screenCfg.ClientTLS = *sc.ClientTLS
+		}
+		result = append(result, &screenCfg)
+	}
+	for i, screenCfg := range result {
+		path, err := settingsPath(screenCfg)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := loadSettings(path)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = withSettings(screenCfg, settings)
+	}
+	return result, nil
 }
 
 func loadConfig() (*DisplayConfig, error) {
@@ -40,6 +243,25 @@ func loadConfig() (*DisplayConfig, error) {
 			return nil, errors.Wrapf(err, "failed to load config from %s", *configPath)
 		}
 	}
+	if cfg.Provision.Enabled {
+		if len(cfg.Screens) > 0 {
+			return nil, errors.New("provisioning supports displays with a single screen only")
+		}
+		dir, err := provisionDir(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.identity, err = provision.Load(dir); err != nil {
+			return nil, err
+		}
+		if cfg.identity != nil {
+			// the configuration of the operator overrides the local file
+			if _, err := toml.Decode(cfg.identity.Config, cfg); err != nil {
+				return nil, errors.Wrapf(err, "failed to load provisioned config from %s", dir)
+			}
+			cfg.Name = cfg.identity.Name
+		}
+	}
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
 		case "debug":
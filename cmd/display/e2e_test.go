@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/je4/securedisplay/config"
+	"github.com/je4/securedisplay/pkg/e2e"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/genericplayer"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// chromeBinaries are the names of chrome searched in the path
+var chromeBinaries = []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "headless-shell"}
+
+// findChrome returns the path of the chrome binary, empty if there is none
+func findChrome() string {
+	for _, name := range chromeBinaries {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// TestEndToEnd runs the path proxy -> display -> headless chrome -> status events with the roundaudio player
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test in short mode")
+	}
+	chromePath := findChrome()
+	if chromePath == "" {
+		t.Skip("chrome not found")
+	}
+
+	const displayName = "display01"
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel).With().Timestamp().Logger()
+	var logger zLogger.ZLogger = &l2
+
+	mediaDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mediaDir, "test.wav"), e2e.GenerateWAV(20*time.Second, 440), 0644); err != nil {
+		t.Fatalf("cannot write test audio: %v", err)
+	}
+
+	h, err := e2e.NewHarness([]string{displayName}, mediaDir, logger)
+	if err != nil {
+		t.Fatalf("cannot create harness: %v", err)
+	}
+	defer h.Close()
+	if err := h.Start(); err != nil {
+		t.Fatalf("cannot start harness: %v", err)
+	}
+
+	conf := &DisplayConfig{}
+	if _, err := toml.Decode(string(config.DisplayToml), conf); err != nil {
+		t.Fatalf("cannot load default config: %v", err)
+	}
+	conf.ProxyAddr = h.ProxyURL()
+	conf.Name = displayName
+	conf.PlayerURL = h.PlayerURL()
+	conf.Kiosk = false
+	conf.Watchdog.Enabled = false
+	conf.Health.Enabled = false
+	conf.Cache.Enabled = false
+	conf.SettingsDir = t.TempDir()
+	conf.Browser.ExecPath = chromePath
+	conf.Browser.Flags = map[string]interface{}{
+		"headless":                  true,
+		"start-fullscreen":          false,
+		"ignore-certificate-errors": true,
+		"autoplay-policy":           "no-user-gesture-required",
+		"mute-audio":                true,
+		"disable-gpu":               true,
+	}
+
+	s := &screen{
+		conf:   conf,
+		logs:   logbuffer.NewBuffer(0),
+		logger: logger,
+	}
+	defer s.stop()
+	if err := s.dial(h.ClientTLS()); err != nil {
+		t.Fatalf("cannot connect display: %v", err)
+	}
+	if err := s.start(); err != nil {
+		t.Fatalf("cannot start display: %v", err)
+	}
+
+	steps := []struct {
+		name  string
+		event event.EventType
+		data  interface{}
+		check func(status *genericplayer.PlayerStatus) bool
+	}{
+		{
+			name:  "load and play",
+			event: "load",
+			data:  h.MediaURL("test.wav"),
+			check: func(status *genericplayer.PlayerStatus) bool {
+				return status.Status == "play" && !status.Paused && status.CurrentTime > 0
+			},
+		},
+		{
+			name:  "pause",
+			event: "pause",
+			check: func(status *genericplayer.PlayerStatus) bool {
+				return status.Paused
+			},
+		},
+		{
+			name:  "resume",
+			event: "play",
+			check: func(status *genericplayer.PlayerStatus) bool {
+				return !status.Paused && status.CurrentTime > 0
+			},
+		},
+		{
+			name:  "stop",
+			event: "stop",
+			check: func(status *genericplayer.PlayerStatus) bool {
+				return status.Paused && status.CurrentTime == 0
+			},
+		},
+	}
+	for _, step := range steps {
+		if err := h.Send(step.event, displayName, step.data); err != nil {
+			t.Fatalf("step %s: cannot send %s: %v", step.name, step.event, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		status, err := h.WaitStatus(ctx, displayName, step.check)
+		cancel()
+		if err != nil {
+			t.Fatalf("step %s: %v", step.name, err)
+		}
+		t.Logf("step %s: %+v", step.name, status)
+	}
+}
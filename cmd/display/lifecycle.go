@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// commandTimeout limits the runtime of the screen power and mixer commands
+const commandTimeout = 30 * time.Second
+
+// command executes the lifecycle events of authorized senders and reports the result to the source
+func (s *screen) command(evt *event.Event) {
+	s.confMu.Lock()
+	conf := s.conf
+	s.confMu.Unlock()
+	result := &event.CommandResult{
+		Command: evt.GetType(),
+		Time:    time.Now(),
+	}
+	var err error
+	var exitCode = -1
+	if !slices.Contains(conf.Lifecycle.Senders, evt.GetSource()) {
+		err = errors.Errorf("%s not allowed to send %s", evt.GetSource(), evt.GetType())
+	} else {
+		switch evt.GetType() {
+		case event.TypeReload:
+			s.logger.Info().Msgf("reloading player page on request of %s", evt.GetSource())
+			if err = s.player.Reload(); err == nil {
+				result.Message = "player page reloaded"
+			}
+		case event.TypeRestartBrowser:
+			s.logger.Warn().Msgf("restarting chrome on request of %s", evt.GetSource())
+			if err = s.browser.Restart(); err == nil {
+				result.Message = "chrome restarted"
+			}
+		case event.TypeRestartDisplay:
+			s.logger.Warn().Msgf("restarting display on request of %s", evt.GetSource())
+			exitCode = conf.Lifecycle.ExitCode
+			result.Message = "exiting for restart"
+		case event.TypeScreenPower:
+			var power = &event.ScreenPower{}
+			if err = evt.GetPageData(power); err != nil {
+				err = errors.Wrap(err, "invalid screen-power")
+				break
+			}
+			s.logger.Info().Msgf("screen power %v on request of %s", power.On, evt.GetSource())
+			var output string
+			if output, err = screenPower(conf, power.On); err == nil {
+				result.Message = "screen off"
+				if power.On {
+					result.Message = "screen on"
+				}
+				if output != "" {
+					result.Message += ": " + output
+				}
+			}
+		}
+	}
+	result.Success = err == nil
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("%s from %s failed", evt.GetType(), evt.GetSource())
+		result.Message = err.Error()
+	}
+	if evt.GetSource() != "" {
+		resultEvt, err := event.NewEvent(result, evt.GetSource(), "")
+		if err != nil {
+			s.logger.Error().Err(err).Msg("cannot create command-result event")
+		} else if err := s.comm.Send(resultEvt); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to send command-result event")
+		}
+	}
+	if exitCode >= 0 && s.restart != nil {
+		// the result is sent, main stops all screens and exits
+		select {
+		case s.restart <- exitCode:
+		default:
+		}
+	}
+}
+
+// screenPower switches the monitor with the configured method and returns the output of the command
+func screenPower(conf *DisplayConfig, on bool) (string, error) {
+	var args []string
+	var stdin string
+	switch conf.Lifecycle.PowerMethod {
+	case "dpms":
+		state := "off"
+		if on {
+			state = "on"
+		}
+		args = []string{"xset", "dpms", "force", state}
+	case "cec":
+		// logical address 0 is the tv
+		stdin = "standby 0\n"
+		if on {
+			stdin = "on 0\n"
+		}
+		args = []string{"cec-client", "-s", "-d", "1"}
+	case "command":
+		args = conf.Lifecycle.PowerOff
+		if on {
+			args = conf.Lifecycle.PowerOn
+		}
+		if len(args) == 0 {
+			return "", errors.New("no power command configured")
+		}
+	case "":
+		return "", errors.New("screen power control disabled")
+	default:
+		return "", errors.Errorf("unknown power method %s", conf.Lifecycle.PowerMethod)
+	}
+	return runCommand(conf, args, stdin)
+}
+
+// runCommand executes args on the display of the browser and returns the output
+func runCommand(conf *DisplayConfig, args []string, stdin string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	if conf.Browser.Display != "" {
+		cmd.Env = append(cmd.Env, "DISPLAY="+conf.Browser.Display)
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var out = &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "%s failed: %s", strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+	return strings.TrimSpace(out.String()), nil
+}
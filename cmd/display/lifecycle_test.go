@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+func TestCommandSenders(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t))
+	var logger zLogger.ZLogger = &l2
+	restart := make(chan int, 1)
+	s := &screen{
+		conf: &DisplayConfig{
+			Lifecycle: LifecycleConfig{ExitCode: 75},
+		},
+		restart: restart,
+		logger:  logger,
+	}
+	// without senders nobody may reload the page or restart the display, the screen has no
+	// player, so an accepted reload would panic
+	s.command(&event.Event{Type: event.TypeReload})
+	s.command(&event.Event{Type: event.TypeRestartDisplay})
+	select {
+	case code := <-restart:
+		t.Fatalf("restart-display accepted without senders, exit code %d", code)
+	default:
+	}
+
+	// events without source are answered by nobody, which keeps the test free of a connection
+	s.conf.Lifecycle.Senders = []string{""}
+	s.command(&event.Event{Type: event.TypeRestartDisplay})
+	select {
+	case code := <-restart:
+		if code != 75 {
+			t.Fatalf("expected exit code 75, got %d", code)
+		}
+	default:
+		t.Fatal("restart-display of an allowed sender refused")
+	}
+}
@@ -1,26 +1,19 @@
 package main
 
 import (
-	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
-	"time"
 
-	"github.com/gorilla/websocket"
-	"github.com/je4/securedisplay/pkg/browser"
-	"github.com/je4/securedisplay/pkg/client"
-	"github.com/je4/securedisplay/pkg/event"
-	"github.com/je4/securedisplay/pkg/genericplayer"
-	"github.com/je4/trustutil/v2/pkg/certutil"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+	"github.com/je4/securedisplay/pkg/reload"
 	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
 	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
 	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
 )
@@ -61,112 +54,99 @@ func main() {
 	if err != nil {
 		log.Fatalf("cannot get hostname: %v", err)
 	}
-	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
+	// the level is set globally to allow changes on reload
+	l2 := _logger.Level(zerolog.TraceLevel).With().Timestamp().Str("host", hostname).Logger() //.Output(output)
 	var logger zLogger.ZLogger = &l2
-
-	certutil.AddDefaultDNSNames("ws:" + conf.Name)
-	clientTLSConfig, clientLoader, err := loader.CreateClientLoader(&conf.ClientTLS, logger)
-	if err != nil {
-		logger.Fatal().Err(err).Msg("cannot create client loader")
-	}
-	defer clientLoader.Close()
-	ca, err := clientLoader.GetCA()
-	if err != nil {
-		logger.Fatal().Err(err).Msg("cannot get CA")
+	if err := reload.SetLogLevel(conf.Log.Level); err != nil {
+		logger.Fatal().Err(err).Msg("cannot set log level")
 	}
-	clientTLSConfig.RootCAs = ca
 
-	wsPath, err := url.JoinPath(conf.ProxyAddr, conf.Name)
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to create websocket path")
-		return
+	if conf.Provision.Enabled && conf.identity == nil {
+		if err := provisionDisplay(conf, logger); err != nil {
+			logger.Fatal().Err(err).Msg("cannot provision display")
+		}
+		if conf, err = loadConfig(); err != nil {
+			logger.Fatal().Err(err).Msg("cannot load provisioned configuration")
+		}
 	}
-	logger.Info().Msgf("Connecting to websocket proxy server at %s", wsPath)
 
-	wsDialer := &websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 45 * time.Second,
-		TLSClientConfig:  clientTLSConfig,
-	}
-	c, _, err := wsDialer.Dial(wsPath, nil)
+	screenConfs, err := conf.screenConfigs()
 	if err != nil {
-		logger.Error().Err(err).Msgf("Failed to connect to websocket proxy server with %s", wsPath)
-		return
-	}
-	defer c.Close()
-
-	comm := client.NewCommunication(c, conf.Name, logger)
-	if err := comm.Start(); err != nil {
-		logger.Error().Err(err).Msg("Failed to start communication")
-		return
+		logger.Fatal().Err(err).Msg("invalid screen configuration")
 	}
+	var screens = []*screen{}
+	restart := make(chan int, 1)
 	defer func() {
-		logger.Info().Msg("Closing communication")
-		if err := comm.Stop(); err != nil {
-			logger.Error().Err(err).Msg("Failed to stop server")
+		for _, s := range screens {
+			s.stop()
 		}
 	}()
-	jsonBytes, err := json.Marshal("core")
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to marshal json")
-	}
-	if err := comm.Send(&event.Event{
-		Type:   event.TypeAttach,
-		Source: conf.Name,
-		Target: "",
-		Token:  "",
-		Data:   jsonBytes,
-	}); err != nil {
-		logger.Error().Err(err).Msg("Failed to send event")
+	for _, screenConf := range screenConfs {
+		logs := logbuffer.NewBuffer(screenConf.LogBuffer.Size)
+		screenLogger := l2.With().Str("screen", screenConf.Name).Logger().Hook(logs)
+		s, err := connectScreen(screenConf, logs, &screenLogger)
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot connect screen %s", screenConf.Name)
+			return
+		}
+		s.restart = restart
+		screens = append(screens, s)
 	}
-	if err := comm.NTP(); err != nil {
+	// all screens share the clock of the first connection
+	if err := screens[0].comm.NTP(); err != nil {
 		logger.Error().Err(err).Msg("Failed to send NTP")
 	}
-	opts := map[string]interface{}{
-		"headless":                            false,
-		"start-fullscreen":                    true,
-		"disable-notifications":               true,
-		"disable-infobars":                    true,
-		"disable-gpu":                         false,
-		"allow-insecure-localhost":            true,
-		"enable-immersive-fullscreen-toolbar": true,
-		"views-browser-windows":               false,
-		"kiosk":                               true,
-		"disable-session-crashed-bubble":      true,
-		"incognito":                           true,
-		"enable-features":                     "AutoplayIgnoreWebAudio",
-		"disable-features":                    "InfiniteSessionRestore,TranslateUI,PreloadMediaEngagementData,MediaEngagementBypassAutoplayPolicies",
-		"autoplay-policy":                     "no-user-gesture-required",
-		//"no-first-run":                        true,
-		"enable-fullscreen-toolbar-reveal": false,
-		"useAutomationExtension":           false,
-		"enable-automation":                false,
-		"mute-audio":                       false,
-	}
-	if !conf.Kiosk {
-		opts["kiosk"] = false
+	for _, s := range screens[1:] {
+		s.comm.ClockOffset = screens[0].comm.ClockOffset
 	}
-	br, err := browser.NewBrowser(opts, logger, func(s string, i ...interface{}) {
-		logger.Debug().Msgf("browser: %s - %v", s, i)
-	})
-	if err != nil {
-		logger.Panic().Err(err).Msg("Failed to create browser")
-	}
-
-	playerFullPath, err := url.JoinPath(conf.PlayerURL, conf.Name)
-	if err != nil {
-		logger.Panic().Err(err).Msg("Failed to create player path")
-	}
-	playerU, err := url.Parse(playerFullPath)
-	if err != nil {
-		logger.Panic().Err(err).Msg("Failed to parse player URL")
+	for _, s := range screens {
+		if err := s.start(); err != nil {
+			logger.Panic().Err(err).Msgf("cannot start screen %s", s.name())
+		}
 	}
 
-	player := genericplayer.NewPlayer(context.Background(), playerU, br, comm, logger)
-	_ = player
+	watcher := reload.NewWatcher(*configPath, conf.ReloadInterval, func() {
+		newConf, err := loadConfig()
+		var newScreenConfs []*DisplayConfig
+		if err == nil {
+			newScreenConfs, err = newConf.screenConfigs()
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid configuration, keeping current settings")
+			for _, s := range screens {
+				s.sendError("invalid configuration: " + err.Error())
+			}
+			return
+		}
+		if len(newScreenConfs) != len(screens) {
+			logger.Warn().Msg("adding or removing screens requires a restart")
+		}
+		for _, s := range screens {
+			i := slices.IndexFunc(newScreenConfs, func(c *DisplayConfig) bool { return c.Name == s.name() })
+			if i < 0 {
+				logger.Warn().Msgf("screen %s removed, requires a restart", s.name())
+				continue
+			}
+			if err := s.reload(newScreenConfs[i]); err != nil {
+				s.logger.Error().Err(err).Msg("invalid configuration, keeping current settings")
+				s.sendError("invalid configuration: " + err.Error())
+			}
+		}
+	}, logger)
+	watcher.Start()
+	defer watcher.Stop()
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM, syscall.SIGTERM)
-	<-sigint
-	logger.Info().Msg("Received shutdown signal")
+	select {
+	case <-sigint:
+		logger.Info().Msg("Received shutdown signal")
+	case exitCode := <-restart:
+		logger.Warn().Msgf("restart requested, exiting with code %d", exitCode)
+		watcher.Stop()
+		for _, s := range screens {
+			s.stop()
+		}
+		os.Exit(exitCode)
+	}
 }
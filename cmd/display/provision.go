@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/browser"
+	"github.com/je4/securedisplay/pkg/provision"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+var pairingTemplate = template.Must(template.New("pairing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+html, body { margin: 0; height: 100%; background: #202020; color: #fff; font-family: sans-serif; }
+body { display: flex; flex-direction: column; justify-content: center; align-items: center; text-align: center; }
+h1 { font-size: 4vw; font-weight: normal; margin: 0 0 0.5em 0; }
+.code { font-size: 16vw; font-family: monospace; letter-spacing: 0.1em; }
+p { font-size: 2vw; color: #aaa; }
+</style>
+</head>
+<body>
+{{ if .Code }}
+<h1>Pairing code</h1>
+<div class="code">{{ .Code }}</div>
+<p>{{ .Hostname }} is waiting for the approval</p>
+{{ else }}
+<h1>{{ .Message }}</h1>
+<p>{{ .Hostname }}</p>
+{{ end }}
+</body>
+</html>`))
+
+// pairingURL renders the pairing code or a message as data url
+func pairingURL(hostname, code, message string) (*url.URL, error) {
+	var buf = &bytes.Buffer{}
+	if err := pairingTemplate.Execute(buf, struct{ Hostname, Code, Message string }{Hostname: hostname, Code: code, Message: message}); err != nil {
+		return nil, errors.Wrap(err, "cannot render pairing page")
+	}
+	u, err := url.Parse("data:text/html;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return u, errors.Wrap(err, "cannot create pairing url")
+}
+
+// provisionDir returns the folder of the provisioned certificate and configuration
+func provisionDir(conf *DisplayConfig) (string, error) {
+	if conf.Provision.Dir != "" {
+		return conf.Provision.Dir, nil
+	}
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get user config folder")
+	}
+	return filepath.Join(userConfigDir, "securedisplay", "provision"), nil
+}
+
+// provisionURL returns the provision endpoint of the proxy
+func provisionURL(conf *DisplayConfig) (*url.URL, error) {
+	u, err := url.Parse(conf.ProxyAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse proxy address %s", conf.ProxyAddr)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	u.Path = "/provision"
+	return u, nil
+}
+
+// provisionDisplay requests a certificate with the bootstrap credential of clienttls. The pairing code is
+// shown until an operator approves the display, then the certificate and configuration are saved.
+func provisionDisplay(conf *DisplayConfig, logger zLogger.ZLogger) error {
+	dir, err := provisionDir(conf)
+	if err != nil {
+		return err
+	}
+	endpoint, err := provisionURL(conf)
+	if err != nil {
+		return err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return errors.Wrap(err, "cannot get hostname")
+	}
+	bootstrapTLSConfig, bootstrapLoader, err := loader.CreateClientLoader(&conf.ClientTLS, logger)
+	if err != nil {
+		return errors.Wrap(err, "cannot create bootstrap client loader")
+	}
+	defer bootstrapLoader.Close()
+	ca, err := bootstrapLoader.GetCA()
+	if err != nil {
+		return errors.Wrap(err, "cannot get CA")
+	}
+	bootstrapTLSConfig.RootCAs = ca
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: bootstrapTLSConfig,
+		},
+	}
+
+	br, err := browser.NewBrowser(browserOptions(conf), launchOptions(conf), logger, func(str string, i ...interface{}) {
+		logger.Debug().Msgf("browser: %s - %v", str, i)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot create browser")
+	}
+	defer br.Close()
+	if err := br.Run(); err != nil {
+		return errors.Wrap(err, "cannot start browser")
+	}
+	show := func(code, message string) {
+		u, err := pairingURL(hostname, code, message)
+		if err == nil {
+			err = br.Navigate(u)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("cannot show pairing page")
+		}
+	}
+
+	keyPEM, csrPEM, err := provision.NewKey(hostname)
+	if err != nil {
+		return err
+	}
+	for {
+		show("", "connecting to "+endpoint.Host)
+		ticket, err := requestProvisioning(client, endpoint, &provision.Request{Hostname: hostname, CSR: string(csrPEM)})
+		if err != nil {
+			logger.Error().Err(err).Msg("cannot request provisioning")
+			time.Sleep(conf.Provision.PollInterval)
+			continue
+		}
+		logger.Info().Msgf("waiting for the approval of provisioning request %s", ticket.ID)
+		show(ticket.Code, "")
+		result, err := waitProvisioning(client, endpoint.JoinPath(ticket.ID), conf.Provision.PollInterval, logger)
+		if err != nil {
+			logger.Error().Err(err).Msgf("provisioning request %s failed", ticket.ID)
+			continue
+		}
+		if result.Status == provision.StatusRejected {
+			show("", "provisioning rejected")
+			return errors.Errorf("provisioning request %s rejected", ticket.ID)
+		}
+		if err := provision.Save(dir, keyPEM, result); err != nil {
+			return err
+		}
+		logger.Info().Msgf("provisioned as %s %v", result.Name, result.Groups)
+		show("", "provisioned as "+result.Name)
+		return nil
+	}
+}
+
+func requestProvisioning(client *http.Client, endpoint *url.URL, req *provision.Request) (*provision.Ticket, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal request")
+	}
+	resp, err := client.Post(endpoint.String(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot post to %s", endpoint.String())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, errors.Errorf("%s: %s", endpoint.String(), resp.Status)
+	}
+	var ticket = &provision.Ticket{}
+	if err := json.NewDecoder(resp.Body).Decode(ticket); err != nil {
+		return nil, errors.Wrap(err, "cannot decode ticket")
+	}
+	return ticket, nil
+}
+
+// waitProvisioning polls the request until it is approved or rejected.
+// An error means the request is lost and must be sent again.
+func waitProvisioning(client *http.Client, u *url.URL, interval time.Duration, logger zLogger.ZLogger) (*provision.Result, error) {
+	for {
+		time.Sleep(interval)
+		resp, err := client.Get(u.String())
+		if err != nil {
+			logger.Warn().Err(err).Msgf("cannot query %s", u.String())
+			continue
+		}
+		var result = &provision.Result{}
+		err = json.NewDecoder(resp.Body).Decode(result)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusAccepted:
+			continue
+		case http.StatusOK, http.StatusForbidden:
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot decode result")
+			}
+			if result.Status != provision.StatusApproved && result.Status != provision.StatusRejected {
+				return nil, errors.Errorf("%s: %s", u.String(), resp.Status)
+			}
+			return result, nil
+		default:
+			return nil, errors.Errorf("%s: %s", u.String(), resp.Status)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/browser"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/policy"
+	"github.com/je4/securedisplay/pkg/reload"
+)
+
+// playerPageURL returns the url of the player page of the display
+func playerPageURL(conf *DisplayConfig) (*url.URL, error) {
+	playerFullPath, err := url.JoinPath(conf.PlayerURL, conf.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create player path from %s", conf.PlayerURL)
+	}
+	u, err := url.Parse(playerFullPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse player url %s", playerFullPath)
+	}
+	return u, nil
+}
+
+// contentRules updates the content policy and the navigation filter of the browser
+func contentRules(conf *DisplayConfig, playerU *url.URL, contentPolicy *policy.Policy, br *browser.Browser, filtered bool) (bool, error) {
+	if err := contentPolicy.Update(conf.Content.AllowedOrigins, conf.Content.TrustedKeys, conf.Content.RequireSignature); err != nil {
+		return filtered, errors.Wrap(err, "invalid content policy")
+	}
+	if !contentPolicy.Restricted() {
+		return filtered, nil
+	}
+	// the player page is always allowed
+	if err := contentPolicy.AddOrigin(playerU.Scheme + "://" + playerU.Host); err != nil {
+		return filtered, errors.Wrap(err, "cannot allow player origin")
+	}
+	if filtered {
+		return true, nil
+	}
+	if err := br.SetNavigationFilter(contentPolicy.AllowOrigin); err != nil {
+		return false, errors.Wrap(err, "cannot set navigation filter")
+	}
+	return true, nil
+}
+
+// reload applies the settings of the changed configuration file
+func (s *screen) reload(newConf *DisplayConfig) error {
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+	if err := s.applyConfig(s.conf, newConf); err != nil {
+		return err
+	}
+	s.conf = newConf
+	return nil
+}
+
+// applyConfig validates newConf and applies the settings, which can be changed without restart.
+// The connection to the proxy is kept.
+func (s *screen) applyConfig(conf, newConf *DisplayConfig) error {
+	if _, err := reload.ParseLogLevel(newConf.Log.Level); err != nil {
+		return err
+	}
+	if newConf.Volume < 0 || newConf.Volume > 1 {
+		return errors.Errorf("invalid volume %v", newConf.Volume)
+	}
+	newPlayerU, err := playerPageURL(newConf)
+	if err != nil {
+		return err
+	}
+	// validate the rules before changing anything
+	if _, err := policy.NewPolicy(newConf.Content.AllowedOrigins, newConf.Content.TrustedKeys, newConf.Content.RequireSignature); err != nil {
+		return errors.Wrap(err, "invalid content policy")
+	}
+
+	if err := reload.SetLogLevel(newConf.Log.Level); err != nil {
+		return err
+	}
+	if s.filtered, err = contentRules(newConf, newPlayerU, s.policy, s.browser, s.filtered); err != nil {
+		return err
+	}
+	if newConf.Kiosk != conf.Kiosk || !reflect.DeepEqual(newConf.Browser, conf.Browser) {
+		s.logger.Info().Msg("browser options changed, restarting browser")
+		if err := s.browser.SetExecOptions(browserOptions(newConf), launchOptions(newConf)); err != nil {
+			return errors.Wrap(err, "invalid browser options")
+		}
+		if err := s.browser.Restart(); err != nil {
+			return errors.Wrap(err, "cannot restart browser")
+		}
+	}
+	if err := s.player.SetURL(newPlayerU); err != nil {
+		return errors.Wrap(err, "cannot load player page")
+	}
+	if newConf.Volume != conf.Volume {
+		s.player.SetVolume(newConf.Volume)
+	}
+	s.player.SetLogSenders(newConf.LogBuffer.Senders)
+	for _, group := range newConf.Groups {
+		if !slices.Contains(conf.Groups, group) {
+			s.group(event.TypeAttach, group)
+		}
+	}
+	for _, group := range conf.Groups {
+		if !slices.Contains(newConf.Groups, group) && group != "core" {
+			s.group(event.TypeDetach, group)
+		}
+	}
+
+	for name, changed := range map[string]bool{
+		"name":      newConf.Name != conf.Name,
+		"proxy":     newConf.ProxyAddr != conf.ProxyAddr,
+		"debug":     newConf.Debug != conf.Debug,
+		"watchdog":  newConf.Watchdog != conf.Watchdog,
+		"health":    newConf.Health != conf.Health,
+		"logbuffer": newConf.LogBuffer.Size != conf.LogBuffer.Size,
+		"cache":     newConf.Cache != conf.Cache,
+		"clienttls": !reflect.DeepEqual(newConf.ClientTLS, conf.ClientTLS),
+		"log":       newConf.Log.File != conf.Log.File || !reflect.DeepEqual(newConf.Log.Stash, conf.Log.Stash),
+	} {
+		if changed {
+			s.logger.Warn().Msgf("configuration change of %s requires a restart", name)
+		}
+	}
+	s.logger.Info().Msg("configuration reloaded")
+	return nil
+}
+
+// browserOptions returns the chrome flags for the display
+func browserOptions(conf *DisplayConfig) map[string]interface{} {
+	opts := map[string]interface{}{
+		"headless":                            false,
+		"start-fullscreen":                    true,
+		"disable-notifications":               true,
+		"disable-infobars":                    true,
+		"disable-gpu":                         false,
+		"allow-insecure-localhost":            true,
+		"enable-immersive-fullscreen-toolbar": true,
+		"views-browser-windows":               false,
+		"kiosk":                               true,
+		"disable-session-crashed-bubble":      true,
+		"incognito":                           true,
+		"enable-features":                     "AutoplayIgnoreWebAudio",
+		"disable-features":                    "InfiniteSessionRestore,TranslateUI,PreloadMediaEngagementData,MediaEngagementBypassAutoplayPolicies",
+		"autoplay-policy":                     "no-user-gesture-required",
+		//"no-first-run":                        true,
+		"enable-fullscreen-toolbar-reveal": false,
+		"useAutomationExtension":           false,
+		"enable-automation":                false,
+		"mute-audio":                       false,
+	}
+	if !conf.Kiosk {
+		opts["kiosk"] = false
+	}
+	if conf.Browser.Width > 0 && conf.Browser.Height > 0 {
+		opts["window-size"] = fmt.Sprintf("%d,%d", conf.Browser.Width, conf.Browser.Height)
+	}
+	if conf.Browser.X != 0 || conf.Browser.Y != 0 {
+		opts["window-position"] = fmt.Sprintf("%d,%d", conf.Browser.X, conf.Browser.Y)
+	}
+	maps.Copy(opts, conf.Browser.Flags)
+	return opts
+}
+
+// launchOptions returns the settings of the chrome process for the display
+func launchOptions(conf *DisplayConfig) *browser.LaunchOptions {
+	launch := &browser.LaunchOptions{
+		ExecPath:    conf.Browser.ExecPath,
+		UserDataDir: conf.Browser.UserDataDir,
+		Extensions:  conf.Browser.Extensions,
+	}
+	if conf.Browser.Display != "" {
+		launch.Env = append(launch.Env, "DISPLAY="+conf.Browser.Display)
+	}
+	return launch
+}
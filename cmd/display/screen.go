@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/pkg/browser"
+	"github.com/je4/securedisplay/pkg/cache"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/genericplayer"
+	"github.com/je4/securedisplay/pkg/health"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+	"github.com/je4/securedisplay/pkg/policy"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/trustutil/v2/pkg/certutil"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+// screen is one window of the display with its own proxy connection, chrome and player
+type screen struct {
+	conf *DisplayConfig
+	// confMu serializes the changes of conf by reload and config-update
+	confMu   sync.Mutex
+	comm     *client.Communication
+	browser  *browser.Browser
+	player   *genericplayer.Player
+	policy   *policy.Policy
+	filtered bool
+	logger   zLogger.ZLogger
+	// logs are the recent messages of logger and the browser console
+	logs *logbuffer.Buffer
+	// cacheTLS is the client identity of the screen for downloads
+	cacheTLS *tls.Config
+	// restart receives the exit code of a restart-display event
+	restart chan<- int
+	// closers are called in reverse order on stop
+	closers []func()
+}
+
+// connectScreen connects the screen to the proxy and attaches it to the core
+func connectScreen(conf *DisplayConfig, logs *logbuffer.Buffer, logger zLogger.ZLogger) (*screen, error) {
+	s := &screen{
+		conf:   conf,
+		logs:   logs,
+		logger: logger,
+	}
+	clientTLSConfig, clientLoader, err := loader.CreateClientLoader(&conf.ClientTLS, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create client loader")
+	}
+	s.closers = append(s.closers, func() { clientLoader.Close() })
+	ca, err := clientLoader.GetCA()
+	if err != nil {
+		s.stop()
+		return nil, errors.Wrap(err, "cannot get CA")
+	}
+	clientTLSConfig.RootCAs = ca
+	var identity *tls.Certificate
+	switch {
+	case conf.identity != nil:
+		identity = &conf.identity.Certificate
+	case conf.ClientTLS.Type == "dev":
+		// the screens of a display must not share a certificate with the names of their siblings
+		cert, err := devCertificate(conf.Name)
+		if err != nil {
+			s.stop()
+			return nil, err
+		}
+		identity = &cert
+	}
+	if identity != nil {
+		clientTLSConfig = clientTLSConfig.Clone()
+		clientTLSConfig.Certificates = []tls.Certificate{*identity}
+		clientTLSConfig.GetClientCertificate = nil
+	}
+	if err := s.dial(clientTLSConfig); err != nil {
+		s.stop()
+		return nil, err
+	}
+	return s, nil
+}
+
+// devCertificate creates a client certificate for ws:<name> with the development ca of certutil
+func devCertificate(name string) (tls.Certificate, error) {
+	ca, caKey, err := certutil.CertificateKeyFromPEM(certutil.DefaultCACrt, certutil.DefaultCAKey, nil)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "cannot decode development ca")
+	}
+	subject := *certutil.DefaultName
+	subject.CommonName = name
+	certPEM, keyPEM, err := certutil.CreateCertificate(
+		true,
+		false,
+		certutil.DefaultDuration,
+		ca,
+		caKey,
+		certutil.DefaultIPAddresses,
+		[]string{"localhost", "ws:" + name},
+		nil,
+		nil,
+		&subject,
+		certutil.DefaultKeyType)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrapf(err, "cannot create certificate for %s", name)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	return cert, errors.Wrapf(err, "cannot load certificate for %s", name)
+}
+
+// dial opens the proxy connection with the client identity and attaches the screen to its groups
+func (s *screen) dial(clientTLSConfig *tls.Config) error {
+	conf := s.conf
+	logger := s.logger
+	wsPath, err := url.JoinPath(conf.ProxyAddr, conf.Name)
+	if err != nil {
+		return errors.Wrap(err, "cannot create websocket path")
+	}
+	logger.Info().Msgf("Connecting to websocket proxy server at %s", wsPath)
+
+	wsDialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  clientTLSConfig,
+	}
+	c, _, err := wsDialer.Dial(wsPath, nil)
+	if err != nil {
+		return errors.Wrapf(err, "cannot connect to websocket proxy server with %s", wsPath)
+	}
+	s.closers = append(s.closers, func() { c.Close() })
+
+	s.comm = client.NewCommunication(transport.NewWebsocket(c), conf.Name, logger)
+	if err := s.comm.Start(); err != nil {
+		return errors.Wrap(err, "cannot start communication")
+	}
+	s.closers = append(s.closers, func() {
+		logger.Info().Msg("Closing communication")
+		if err := s.comm.Stop(); err != nil {
+			logger.Error().Err(err).Msg("Failed to stop server")
+		}
+	})
+	for _, group := range append([]string{"core"}, conf.Groups...) {
+		s.group(event.TypeAttach, group)
+	}
+	s.cacheTLS = clientTLSConfig
+	return nil
+}
+
+// start creates chrome, the player, the cache and the watchdog of the screen
+func (s *screen) start() error {
+	conf := s.conf
+	logger := s.logger
+	br, err := browser.NewBrowser(browserOptions(conf), launchOptions(conf), logger, func(str string, i ...interface{}) {
+		logger.Debug().Msgf("browser: %s - %v", str, i)
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot create browser")
+	}
+	s.browser = br
+	s.closers = append(s.closers, br.Close)
+	br.OnConsole(func(level string, message string) {
+		s.logs.Add(&event.LogEntry{
+			Time:    time.Now(),
+			Source:  event.LogSourceBrowser,
+			Level:   level,
+			Message: message,
+		})
+	})
+
+	playerU, err := playerPageURL(conf)
+	if err != nil {
+		return errors.Wrap(err, "cannot create player URL")
+	}
+
+	s.policy = &policy.Policy{}
+	if s.filtered, err = contentRules(conf, playerU, s.policy, br, false); err != nil {
+		return errors.Wrap(err, "cannot create content policy")
+	}
+
+	var cacheServer *cache.Server
+	if conf.Cache.Enabled {
+		cacheDir := conf.Cache.Dir
+		if cacheDir == "" {
+			userCacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return errors.Wrap(err, "cannot get user cache folder")
+			}
+			cacheDir = filepath.Join(userCacheDir, "securedisplay", conf.Name)
+		}
+		contentCache, err := cache.NewCache(cacheDir, conf.Cache.MaxSize*1024*1024, &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: s.cacheTLS,
+			},
+		}, logger)
+		if err != nil {
+			return errors.Wrapf(err, "cannot open cache %s", cacheDir)
+		}
+		cacheServer = cache.NewServer(contentCache, conf.Cache.Addr)
+		if err := cacheServer.Start(); err != nil {
+			return errors.Wrap(err, "cannot start cache server")
+		}
+		s.closers = append(s.closers, func() { cacheServer.Stop() })
+	}
+
+	s.player = genericplayer.NewPlayer(context.Background(), playerU, br, s.comm, s.policy, cacheServer, logger)
+	s.player.SetVolume(conf.Volume)
+	s.player.SetConfigHandler(s.configUpdate)
+	s.player.SetLogs(s.logs)
+	s.player.SetLogSenders(conf.LogBuffer.Senders)
+	s.player.SetCommandHandler(s.command)
+	s.player.SetAudioHandler(s.systemAudio)
+	s.closers = append(s.closers, s.player.Close)
+
+	if conf.Watchdog.Enabled {
+		watchdog := browser.NewWatchdog(br, conf.Watchdog.Interval, conf.Watchdog.Deadline, conf.Watchdog.MaxFailures, func(rec *browser.Recovery) {
+			evt, err := event.NewEvent(rec, "core", "")
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to create recovery event")
+				return
+			}
+			if err := s.comm.Send(evt); err != nil {
+				logger.Error().Err(err).Msg("Failed to send recovery event")
+			}
+		}, logger)
+		watchdog.Start()
+		s.closers = append(s.closers, watchdog.Stop)
+	}
+
+	if conf.Health.Enabled {
+		reporter := health.NewReporter(conf.Health.Interval, conf.Health.Disk, br.Metrics, func(h *event.Health) {
+			evt, err := event.NewEvent(h, "core", "")
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to create health event")
+				return
+			}
+			if err := s.comm.Send(evt); err != nil {
+				logger.Error().Err(err).Msg("Failed to send health event")
+			}
+		}, logger)
+		reporter.Start()
+		s.closers = append(s.closers, reporter.Stop)
+	}
+	return nil
+}
+
+// name returns the name of the screen
+func (s *screen) name() string {
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+	return s.conf.Name
+}
+
+// group joins or leaves a group with an attach or detach event
+func (s *screen) group(t event.EventType, group string) {
+	jsonBytes, err := json.Marshal(group)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to marshal json")
+	}
+	if err := s.comm.Send(&event.Event{
+		Type:   t,
+		Source: s.conf.Name,
+		Target: "",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to send event")
+	}
+}
+
+// sendError reports a problem of the display to the core
+func (s *screen) sendError(msg string) {
+	jsonBytes, _ := json.Marshal(msg)
+	if err := s.comm.Send(&event.Event{
+		Type:   event.TypeError,
+		Source: "",
+		Target: "core",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to send error event")
+	}
+}
+
+// stop closes everything opened by connectScreen and start
+func (s *screen) stop() {
+	for _, closer := range slices.Backward(s.closers) {
+		closer()
+	}
+	s.closers = nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/x509"
+	"slices"
+	"testing"
+)
+
+func TestDevCertificate(t *testing.T) {
+	if _, err := devCertificate("display01-left"); err != nil {
+		t.Fatalf("cannot create first certificate: %v", err)
+	}
+	cert, err := devCertificate("display01-right")
+	if err != nil {
+		t.Fatalf("cannot create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("cannot parse certificate: %v", err)
+	}
+	if !slices.Contains(leaf.DNSNames, "ws:display01-right") {
+		t.Fatalf("ws:display01-right missing in %v", leaf.DNSNames)
+	}
+	// the names of sibling screens must not leak into the certificate
+	if slices.Contains(leaf.DNSNames, "ws:display01-left") {
+		t.Fatalf("certificate contains the sibling name: %v", leaf.DNSNames)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/policy"
+)
+
+// settingsPath returns the file of the settings pushed to the display with config-update events
+func settingsPath(conf *DisplayConfig) (string, error) {
+	dir := conf.SettingsDir
+	if dir == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", errors.Wrap(err, "cannot get user config folder")
+		}
+		dir = filepath.Join(userConfigDir, "securedisplay", "settings")
+	}
+	return filepath.Join(dir, conf.Name+".json"), nil
+}
+
+// loadSettings reads the pushed settings, an empty Settings is returned if there are none
+func loadSettings(path string) (*event.Settings, error) {
+	var settings = &event.Settings{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return settings, nil
+		}
+		return nil, errors.Wrapf(err, "cannot read settings %s", path)
+	}
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode settings %s", path)
+	}
+	return settings, nil
+}
+
+func saveSettings(path string, settings *event.Settings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "cannot encode settings")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "cannot create %s", filepath.Dir(path))
+	}
+	// replace the file atomically
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "cannot write %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, path), "cannot rename %s", tmp)
+}
+
+// pushedPlayerAllowed checks that the origin of a pushed player url is in the allowed origins of conf.
+// Only the origin of the locally configured player is added to the content policy automatically.
+func pushedPlayerAllowed(conf *DisplayConfig, playerURL string) error {
+	contentPolicy, err := policy.NewPolicy(conf.Content.AllowedOrigins, nil, false)
+	if err != nil {
+		return errors.Wrap(err, "invalid content policy")
+	}
+	u, err := url.Parse(playerURL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid player url %s", playerURL)
+	}
+	if !contentPolicy.AllowOrigin(u) {
+		return errors.Errorf("origin of player url %s not in allowed origins", playerURL)
+	}
+	return nil
+}
+
+// withSettings returns a copy of conf with the pushed settings. The content policy is never taken
+// from them and a player url outside of the allowed origins is ignored.
+func withSettings(conf *DisplayConfig, settings *event.Settings) *DisplayConfig {
+	newConf := *conf
+	if settings.PlayerURL != nil && pushedPlayerAllowed(conf, *settings.PlayerURL) == nil {
+		newConf.PlayerURL = *settings.PlayerURL
+	}
+	if settings.Volume != nil {
+		newConf.Volume = *settings.Volume
+	}
+	if settings.Groups != nil {
+		newConf.Groups = slices.Clone(*settings.Groups)
+	}
+	return &newConf
+}
+
+// configHash returns the sha256 of the configuration
+func configHash(conf *DisplayConfig) (string, error) {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot encode configuration")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configUpdate validates and applies the settings of a config-update event of an allowed sender.
+// They are stored and used on the next start.
+func (s *screen) configUpdate(source string, update *event.Settings) (string, error) {
+	s.confMu.Lock()
+	defer s.confMu.Unlock()
+	if !slices.Contains(s.conf.SettingsSenders, source) {
+		return "", errors.Errorf("%s not allowed to send config-update", source)
+	}
+	if update.AllowedOrigins != nil || update.RequireSignature != nil || update.TrustedKeys != nil {
+		return "", errors.New("content policy cannot be changed with config-update")
+	}
+	if update.PlayerURL != nil {
+		if err := pushedPlayerAllowed(s.conf, *update.PlayerURL); err != nil {
+			return "", err
+		}
+	}
+	path, err := settingsPath(s.conf)
+	if err != nil {
+		return "", err
+	}
+	settings, err := loadSettings(path)
+	if err != nil {
+		return "", err
+	}
+	settings.Merge(update)
+	newConf := withSettings(s.conf, update)
+	if newConf.PlayerURL == "" {
+		return "", errors.New("empty player url")
+	}
+	if err := s.applyConfig(s.conf, newConf); err != nil {
+		return "", err
+	}
+	s.conf = newConf
+	if err := saveSettings(path, settings); err != nil {
+		return "", err
+	}
+	s.logger.Info().Msgf("settings stored in %s", path)
+	return configHash(newConf)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// TestConfigUpdate checks the refused config-updates, they are rejected before anything is applied
+func TestConfigUpdate(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t))
+	var logger zLogger.ZLogger = &l2
+	s := &screen{
+		conf: &DisplayConfig{
+			Name:            "display01",
+			PlayerURL:       "https://localhost/player",
+			SettingsDir:     t.TempDir(),
+			SettingsSenders: []string{"core01"},
+		},
+		logger: logger,
+	}
+	volume := 0.5
+	if _, err := s.configUpdate("page01", &event.Settings{Volume: &volume}); err == nil {
+		t.Fatal("config-update of page01 accepted")
+	}
+	origins := []string{"https://example.com"}
+	if _, err := s.configUpdate("core01", &event.Settings{AllowedOrigins: &origins}); err == nil {
+		t.Fatal("content policy accepted")
+	}
+	s.conf.Content.AllowedOrigins = []string{"https://localhost"}
+	playerURL := "https://evil.example.com/player"
+	if _, err := s.configUpdate("core01", &event.Settings{PlayerURL: &playerURL}); err == nil {
+		t.Fatal("player url outside of the allowed origins accepted")
+	}
+	if conf := withSettings(s.conf, &event.Settings{PlayerURL: &playerURL}); conf.PlayerURL != s.conf.PlayerURL {
+		t.Fatalf("stored player url %s outside of the allowed origins applied", conf.PlayerURL)
+	}
+	playerURL = "https://localhost/other"
+	if conf := withSettings(s.conf, &event.Settings{PlayerURL: &playerURL}); conf.PlayerURL != playerURL {
+		t.Fatalf("expected player url %s, got %s", playerURL, conf.PlayerURL)
+	}
+
+	s.conf.SettingsSenders = nil
+	if _, err := s.configUpdate("core01", &event.Settings{Volume: &volume}); err == nil {
+		t.Fatal("config-update accepted without senders")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/policy"
+)
+
+var genKey = flag.Bool("genkey", false, "generate a new signing key pair")
+var keyPath = flag.String("key", "", "path to the base64 encoded ed25519 private key")
+var contentURL = flag.String("url", "", "content url to sign")
+var ttl = flag.Duration("ttl", 0, "validity of the manifest, 0: no expiry")
+
+// manifest creates signing keys and signed content manifests for displays with require_signature
+func main() {
+	flag.Parse()
+	if *genKey {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatalf("cannot generate key: %v", err)
+		}
+		fmt.Printf("private key: %s\n", base64.StdEncoding.EncodeToString(priv.Seed()))
+		fmt.Printf("public key:  %s\n", base64.StdEncoding.EncodeToString(pub))
+		return
+	}
+	if *keyPath == "" || *contentURL == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	keyBytes, err := os.ReadFile(*keyPath)
+	if err != nil {
+		log.Fatalf("cannot read key %s: %v", *keyPath, err)
+	}
+	key, err := policy.ParsePrivateKey(string(keyBytes))
+	if err != nil {
+		log.Fatalf("invalid key %s: %v", *keyPath, err)
+	}
+	m := &policy.Manifest{URL: *contentURL}
+	if *ttl > 0 {
+		m.Expires = time.Now().Add(*ttl).UTC()
+	}
+	token, err := policy.SignManifest(key, m)
+	if err != nil {
+		log.Fatalf("cannot sign manifest: %v", err)
+	}
+	fmt.Println(token)
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"flag"
+	"os"
 	"runtime"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/BurntSushi/toml"
 	"github.com/je4/securedisplay/config"
+	"github.com/je4/securedisplay/pkg/provision"
+	"github.com/je4/securedisplay/pkg/proxy"
 	"github.com/je4/utils/v2/pkg/stashconfig"
 	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
 )
@@ -18,16 +22,104 @@ var numWorker = flag.Int("workers", runtime.NumCPU(), "number of workers")
 var debug = flag.Bool("debug", false, "debug mode")
 var webFolder = flag.String("web", "", "web folder to serve the display from")
 var configPath = flag.String("config", "", "path to config file")
+var storePath = flag.String("store", "", "path to the state database")
+
+type StoreConfig struct {
+	// Path of the bbolt database, empty disables persistence
+	Path string `toml:"path"`
+	// QueueSize is the maximum number of queued events per offline destination
+	QueueSize int `toml:"queue_size"`
+	// QueueTotal is the maximum number of queued events of all destinations
+	QueueTotal int `toml:"queue_total"`
+	// QueueMaxAge is the maximum age of queued events, older events are dropped
+	QueueMaxAge time.Duration `toml:"queue_max_age"`
+	// PlaybackMaxAge is the maximum age of queued playback commands like load and play
+	PlaybackMaxAge time.Duration `toml:"playback_max_age"`
+}
+
+type AuditConfig struct {
+	// Path of the audit log file, empty disables the audit log
+	Path string `toml:"path"`
+	// SyncInterval batches the syncs of the audit log to disk, 0 syncs every entry
+	SyncInterval time.Duration `toml:"sync_interval"`
+	// Admins are the certificate names (ws:<name>) allowed to query the audit log, empty denies all clients
+	Admins []string `toml:"admins"`
+}
+
+type EmergencyConfig struct {
+	// Senders are the client names allowed to send emergency events, empty denies all clients
+	Senders []string `toml:"senders"`
+}
+
+type ProvisionConfig struct {
+	// Enabled provides /provision for new displays and the approval page /admin/provision
+	Enabled bool `toml:"enabled"`
+	// Bootstrap are the certificate dns names of the bootstrap credentials of new displays
+	Bootstrap []string `toml:"bootstrap"`
+	// CACert and CAKey are the PEM files of the CA, which signs the display certificates
+	CACert string `toml:"ca_cert"`
+	CAKey  string `toml:"ca_key"`
+	// Validity of the display certificates
+	Validity time.Duration `toml:"validity"`
+	// MaxAge of requests waiting for approval
+	MaxAge time.Duration `toml:"max_age"`
+	// DisplayConfig is the path of the toml configuration sent to approved displays, empty sends none
+	DisplayConfig string `toml:"display_config"`
+	// Admins are the certificate names (ws:<name>) allowed to approve displays, empty denies all clients
+	Admins []string `toml:"admins"`
+	// Reserved are names, which cannot be given to displays
+	Reserved []string `toml:"reserved"`
+}
 
 type ProxyConfig struct {
-	LocalAddr    string             `toml:"localaddr"`
-	ExternalAddr string             `toml:"externaladdr"`
-	NTP          string             `toml:"ntp"`
-	NumWorkers   int                `toml:"num_workers"`
-	Debug        bool               `toml:"debug"`
-	WebFolder    string             `toml:"web_folder"`
-	ServerTLS    loader.Config      `toml:"servertls"`
-	Log          stashconfig.Config `toml:"log"`
+	LocalAddr    string          `toml:"localaddr"`
+	ExternalAddr string          `toml:"externaladdr"`
+	NTP          string          `toml:"ntp"`
+	NumWorkers   int             `toml:"num_workers"`
+	Debug        bool            `toml:"debug"`
+	WebFolder    string          `toml:"web_folder"`
+	Store        StoreConfig     `toml:"store"`
+	Audit        AuditConfig     `toml:"audit"`
+	Emergency    EmergencyConfig `toml:"emergency"`
+	Provision    ProvisionConfig `toml:"provision"`
+	// Groups are static group memberships: group -> client names
+	Groups    map[string][]string `toml:"groups"`
+	Grouping  proxy.Grouping      `toml:"grouping"`
+	ServerTLS loader.Config       `toml:"servertls"`
+	Log       stashconfig.Config  `toml:"log"`
+
+	// ReloadInterval is the interval to check the config file for changes, 0 reloads on SIGHUP only
+	ReloadInterval time.Duration `toml:"reload_interval"`
+}
+
+// provisioning loads the CA and the display configuration for the provisioning of new displays
+func (cfg *ProvisionConfig) provisioning() (*proxy.Provisioning, error) {
+	ca, err := provision.LoadCA(cfg.CACert, cfg.CAKey)
+	if err != nil {
+		return nil, err
+	}
+	var displayConfig []byte
+	if cfg.DisplayConfig != "" {
+		if displayConfig, err = os.ReadFile(cfg.DisplayConfig); err != nil {
+			return nil, errors.Wrapf(err, "cannot read display config %s", cfg.DisplayConfig)
+		}
+		// do not send broken files to the displays
+		if _, err := toml.Decode(string(displayConfig), &map[string]interface{}{}); err != nil {
+			return nil, errors.Wrapf(err, "invalid display config %s", cfg.DisplayConfig)
+		}
+	}
+	if len(cfg.Bootstrap) == 0 {
+		return nil, errors.New("no bootstrap certificate names")
+	}
+	return &proxy.Provisioning{
+		CA:             ca,
+		BootstrapNames: cfg.Bootstrap,
+		Validity:       cfg.Validity,
+		MaxAge:         cfg.MaxAge,
+		DisplayConfig:  string(displayConfig),
+		Admins:         cfg.Admins,
+		ReservedNames:  cfg.Reserved,
+	}, nil
 }
 
 func loadConfig() (*ProxyConfig, error) {
@@ -57,6 +149,8 @@ func loadConfig() (*ProxyConfig, error) {
 			cfg.LocalAddr = *addr
 		case "ext":
 			cfg.ExternalAddr = *ext
+		case "store":
+			cfg.Store.Path = *storePath
 		}
 	})
 
@@ -11,7 +11,9 @@ import (
 	"syscall"
 
 	"github.com/je4/securedisplay/pkg/proxy"
+	"github.com/je4/securedisplay/pkg/reload"
 	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
 	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
 	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
 )
@@ -53,8 +55,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("cannot get hostname: %v", err)
 	}
-	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
+	// the level is set globally to allow changes on reload
+	l2 := _logger.Level(zerolog.TraceLevel).With().Timestamp().Str("host", hostname).Logger() //.Output(output)
 	var logger zLogger.ZLogger = &l2
+	if err := reload.SetLogLevel(conf.Log.Level); err != nil {
+		logger.Fatal().Err(err).Msg("cannot set log level")
+	}
 
 	serverTLSConfig, serverLoader, err := loader.CreateServerLoader(true, &conf.ServerTLS, nil, logger)
 	if err != nil {
@@ -81,10 +87,64 @@ func main() {
 		logger.Error().Err(err).Msg("Failed to create server")
 		return
 	}
+	if conf.Store.Path != "" {
+		store, err := proxy.NewStore(conf.Store.Path)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to open store %s", conf.Store.Path)
+			return
+		}
+		defer store.Close()
+		if err := srv.SetStore(store, conf.Store.QueueSize, conf.Store.QueueTotal, conf.Store.QueueMaxAge, conf.Store.PlaybackMaxAge); err != nil {
+			logger.Error().Err(err).Msg("Failed to load state from store")
+			return
+		}
+	}
+	if conf.Audit.Path != "" {
+		auditLog, err := proxy.NewAuditLog(conf.Audit.Path, conf.Audit.SyncInterval, logger)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to open audit log %s", conf.Audit.Path)
+			return
+		}
+		defer auditLog.Close()
+		srv.SetAuditLog(auditLog, conf.Audit.Admins)
+	}
+	if err := conf.Grouping.Validate(); err != nil {
+		logger.Error().Err(err).Msg("Failed to validate grouping")
+		return
+	}
+	srv.SetGrouping(&conf.Grouping)
+	srv.SetEmergencySenders(conf.Emergency.Senders)
+	if conf.Provision.Enabled {
+		provisioning, err := conf.Provision.provisioning()
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to enable provisioning")
+			return
+		}
+		srv.SetProvisioning(provisioning)
+	}
+	for group, members := range conf.Groups {
+		for _, name := range members {
+			srv.AddToGroup(name, group)
+		}
+	}
 	if err := srv.Start(serverTLSConfig); err != nil {
 		logger.Error().Err(err).Msg("Failed to start server")
 		return
 	}
+	watcher := reload.NewWatcher(*configPath, conf.ReloadInterval, func() {
+		newConf, err := loadConfig()
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid configuration, keeping current settings")
+			return
+		}
+		if err := applyConfig(srv, conf, newConf, logger); err != nil {
+			logger.Error().Err(err).Msg("invalid configuration, keeping current settings")
+			return
+		}
+		conf = newConf
+	}, logger)
+	watcher.Start()
+	defer watcher.Stop()
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGKILL, syscall.SIGTERM)
 	<-sigint
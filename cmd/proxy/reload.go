@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/proxy"
+	"github.com/je4/securedisplay/pkg/reload"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// applyConfig validates newConf and applies the settings, which can be changed without restart.
+// Connections are kept.
+func applyConfig(srv *proxy.SocketServer, conf, newConf *ProxyConfig, logger zLogger.ZLogger) error {
+	if _, err := reload.ParseLogLevel(newConf.Log.Level); err != nil {
+		return err
+	}
+	if newConf.NumWorkers < 1 {
+		return errors.Errorf("invalid number of workers %d", newConf.NumWorkers)
+	}
+	if err := newConf.Grouping.Validate(); err != nil {
+		return err
+	}
+
+	var provisioning *proxy.Provisioning
+	if newConf.Provision.Enabled {
+		var err error
+		if provisioning, err = newConf.Provision.provisioning(); err != nil {
+			return errors.Wrap(err, "invalid provisioning")
+		}
+	}
+
+	if err := reload.SetLogLevel(newConf.Log.Level); err != nil {
+		return err
+	}
+	if newConf.NumWorkers != conf.NumWorkers {
+		logger.Info().Msgf("workers: %d -> %d", conf.NumWorkers, newConf.NumWorkers)
+		srv.SetNumWorkers(newConf.NumWorkers)
+	}
+	if newConf.NTP != conf.NTP {
+		logger.Info().Msgf("ntp server: %s -> %s", conf.NTP, newConf.NTP)
+		srv.SetNTPServer(newConf.NTP)
+	}
+	srv.SetGrouping(&newConf.Grouping)
+	srv.SetEmergencySenders(newConf.Emergency.Senders)
+	srv.SetAdmins(newConf.Audit.Admins)
+	if newConf.Provision.Enabled != conf.Provision.Enabled {
+		logger.Info().Msgf("provisioning enabled: %v -> %v", conf.Provision.Enabled, newConf.Provision.Enabled)
+	}
+	srv.SetProvisioning(provisioning)
+	for group, members := range newConf.Groups {
+		for _, name := range members {
+			srv.AddToGroup(name, group)
+		}
+	}
+	for group, members := range conf.Groups {
+		for _, name := range members {
+			if !slices.Contains(newConf.Groups[group], name) {
+				logger.Info().Msgf("%s removed from group %s", name, group)
+				srv.RemoveFromGroup(name, group)
+			}
+		}
+	}
+
+	for name, changed := range map[string]bool{
+		"localaddr/externaladdr": newConf.LocalAddr != conf.LocalAddr || newConf.ExternalAddr != conf.ExternalAddr,
+		"web_folder":             newConf.WebFolder != conf.WebFolder,
+		"debug":                  newConf.Debug != conf.Debug,
+		"store":                  newConf.Store != conf.Store,
+		"audit.path":             newConf.Audit.Path != conf.Audit.Path || newConf.Audit.SyncInterval != conf.Audit.SyncInterval,
+		"servertls":              !reflect.DeepEqual(newConf.ServerTLS, conf.ServerTLS),
+		"log":                    newConf.Log.File != conf.Log.File || !reflect.DeepEqual(newConf.Log.Stash, conf.Log.Stash),
+	} {
+		if changed {
+			logger.Warn().Msgf("configuration change of %s requires a restart", name)
+		}
+	}
+	logger.Info().Msg("configuration reloaded")
+	return nil
+}
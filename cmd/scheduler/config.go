@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+
+	"emperror.dev/errors"
+	"github.com/BurntSushi/toml"
+	"github.com/je4/securedisplay/config"
+	"github.com/je4/utils/v2/pkg/stashconfig"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+var name = flag.String("name", "", "name of the scheduler client")
+var proxy = flag.String("proxy", "", "address of the websocket proxy server")
+var schedulePath = flag.String("schedule", "", "path to schedule definition (toml or json)")
+var configPath = flag.String("config", "", "path to config file")
+
+type SchedulerConfig struct {
+	ProxyAddr string             `toml:"proxy"`
+	Name      string             `toml:"name"`
+	Schedule  string             `toml:"schedule"`
+	ClientTLS loader.Config      `toml:"clienttls"`
+	Log       stashconfig.Config `toml:"log"`
+}
+
+func loadConfig() (*SchedulerConfig, error) {
+	flag.Parse()
+	cfg := &SchedulerConfig{}
+	// fill the default values
+	if _, err := toml.Decode(string(config.SchedulerToml), cfg); err != nil {
+		return nil, errors.Wrap(err, "failed to load default config from")
+	}
+	if *configPath != "" {
+		// enhance it with the external file
+		if _, err := toml.DecodeFile(*configPath, cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to load config from %s", *configPath)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			cfg.Name = *name
+		case "proxy":
+			cfg.ProxyAddr = *proxy
+		case "schedule":
+			cfg.Schedule = *schedulePath
+		}
+	})
+
+	return cfg, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/scheduler"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/trustutil/v2/pkg/certutil"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	ublogger "gitlab.switch.ch/ub-unibas/go-ublogger/v2"
+	"go.ub.unibas.ch/cloud/certloader/v2/pkg/loader"
+)
+
+func main() {
+
+	conf, err := loadConfig()
+	if err != nil {
+		panic(fmt.Sprintf("Error loading config: %v", err))
+	}
+	var loggerTLSConfig *tls.Config
+	var loggerLoader io.Closer
+	if conf.Log.Stash.TLS != nil {
+		loggerTLSConfig, loggerLoader, err = loader.CreateClientLoader(conf.Log.Stash.TLS, nil)
+		if err != nil {
+			log.Fatalf("cannot create stash client loader: %v", err)
+		}
+		defer loggerLoader.Close()
+	}
+
+	_logger, _logstash, _logfile, err := ublogger.CreateUbMultiLoggerTLS(conf.Log.Level, conf.Log.File,
+		ublogger.SetDataset(conf.Log.Stash.Dataset),
+		ublogger.SetLogStash(conf.Log.Stash.LogstashHost, conf.Log.Stash.LogstashPort, conf.Log.Stash.Namespace, conf.Log.Stash.LogstashTraceLevel),
+		ublogger.SetTLS(conf.Log.Stash.TLS != nil),
+		ublogger.SetTLSConfig(loggerTLSConfig),
+	)
+	if err != nil {
+		log.Fatalf("cannot create logger: %v", err)
+	}
+	if _logstash != nil {
+		defer _logstash.Close()
+	}
+	if _logfile != nil {
+		defer _logfile.Close()
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("cannot get hostname: %v", err)
+	}
+	l2 := _logger.With().Timestamp().Str("host", hostname).Logger() //.Output(output)
+	var logger zLogger.ZLogger = &l2
+
+	def, err := scheduler.LoadDefinition(conf.Schedule)
+	if err != nil {
+		logger.Fatal().Err(err).Msgf("cannot load schedule %s", conf.Schedule)
+	}
+
+	certutil.AddDefaultDNSNames("ws:" + conf.Name)
+	clientTLSConfig, clientLoader, err := loader.CreateClientLoader(&conf.ClientTLS, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot create client loader")
+	}
+	defer clientLoader.Close()
+	ca, err := clientLoader.GetCA()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("cannot get CA")
+	}
+	clientTLSConfig.RootCAs = ca
+
+	wsPath, err := url.JoinPath(conf.ProxyAddr, conf.Name)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create websocket path")
+		return
+	}
+	logger.Info().Msgf("Connecting to websocket proxy server at %s", wsPath)
+
+	wsDialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		TLSClientConfig:  clientTLSConfig,
+	}
+	c, _, err := wsDialer.Dial(wsPath, nil)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to connect to websocket proxy server with %s", wsPath)
+		return
+	}
+	defer c.Close()
+
+	comm := client.NewCommunication(transport.NewWebsocket(c), conf.Name, logger)
+	sched := scheduler.NewScheduler(def, comm, logger)
+	comm.On(func(evt *event.Event) {
+		if evt.GetType() == event.TypeEnded {
+			sched.Ended(evt.GetSource())
+		}
+	})
+	if err := comm.Start(); err != nil {
+		logger.Error().Err(err).Msg("Failed to start communication")
+		return
+	}
+	defer func() {
+		logger.Info().Msg("Closing communication")
+		if err := comm.Stop(); err != nil {
+			logger.Error().Err(err).Msg("Failed to stop server")
+		}
+	}()
+	// displays send their events to core
+	jsonBytes, err := json.Marshal("core")
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to marshal json")
+	}
+	if err := comm.Send(&event.Event{
+		Type:   event.TypeAttach,
+		Source: conf.Name,
+		Target: "",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to send event")
+	}
+
+	sched.Start()
+	defer sched.Stop()
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	<-sigint
+	logger.Info().Msg("Received shutdown signal")
+}
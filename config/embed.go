@@ -7,3 +7,9 @@ var ProxyToml []byte
 
 //go:embed displaydefault.toml
 var DisplayToml []byte
+
+//go:embed schedulerdefault.toml
+var SchedulerToml []byte
+
+//go:embed coredefault.toml
+var CoreToml []byte
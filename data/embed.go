@@ -3,5 +3,5 @@ package data
 import "embed"
 
 //go:embed static/js/reconnecting-websocket.js static/js/reconnecting-websocket.min.js
-//go:embed templates/roundaudio.gohtml templates/echo.gohtml templates/control.gohtml
+//go:embed templates/roundaudio.gohtml templates/echo.gohtml templates/control.gohtml templates/core.gohtml
 var FS embed.FS
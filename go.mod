@@ -12,10 +12,12 @@ require (
 	github.com/gin-contrib/cors v1.7.6
 	github.com/gin-gonic/gin v1.11.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/je4/trustutil/v2 v2.0.31
 	github.com/je4/utils/v2 v2.0.62
 	github.com/rs/zerolog v1.34.0
 	github.com/sahmad98/go-ringbuffer v1.1.0
 	gitlab.switch.ch/ub-unibas/go-ublogger/v2 v2.0.1
+	go.etcd.io/bbolt v1.4.3
 	go.ub.unibas.ch/cloud/certloader/v2 v2.0.24
 	go.ub.unibas.ch/cloud/miniresolverclient v1.0.0
 	golang.org/x/net v0.49.0
@@ -41,7 +43,6 @@ require (
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/goccy/go-yaml v1.19.2 // indirect
 	github.com/google/certificate-transparency-go v1.3.2 // indirect
-	github.com/je4/trustutil/v2 v2.0.31 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/cpuid/v2 v2.3.0 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// BridgeBinding is the name of the binding function in the page
+const BridgeBinding = "__securedisplayBridge"
+
+//go:embed bridge.js
+var bridgeSDK string
+
+// BridgeMessage is sent by the page via securedisplay.emit(type, data)
+type BridgeMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type bridgeFuncType func(msg *BridgeMessage)
+
+// OnBridge sets the receiver for messages emitted by the page
+func (browser *Browser) OnBridge(bridgeFunc func(msg *BridgeMessage)) {
+	browser.bridgeFunc = bridgeFunc
+}
+
+// bridgeSetup adds the binding and injects the sdk into every new document
+func (browser *Browser) bridgeSetup() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := runtime.AddBinding(BridgeBinding).Do(ctx); err != nil {
+			return errors.Wrapf(err, "cannot add binding %s", BridgeBinding)
+		}
+		if _, err := page.AddScriptToEvaluateOnNewDocument(bridgeSDK).Do(ctx); err != nil {
+			return errors.Wrap(err, "cannot inject bridge sdk")
+		}
+		return nil
+	})
+}
+
+func (browser *Browser) bridgeCalled(ctx context.Context, ev *runtime.EventBindingCalled) {
+	if ev.Name != BridgeBinding {
+		return
+	}
+	if ctx != browser.activeCtx() {
+		browser.log.Debug().Msgf("ignoring bridge message of background tab: %s", ev.Payload)
+		return
+	}
+	var msg = &BridgeMessage{}
+	if err := json.Unmarshal([]byte(ev.Payload), msg); err != nil {
+		browser.log.Error().Err(err).Msgf("cannot unmarshal bridge message: %s", ev.Payload)
+		return
+	}
+	if browser.bridgeFunc == nil {
+		browser.log.Debug().Msgf("no receiver function set for bridge message %s", msg.Type)
+		return
+	}
+	// do not block the event listener of chromedp
+	go browser.bridgeFunc(msg)
+}
+
+// CallBridge calls the javascript handler registered with securedisplay.on(handler, ...).
+// The result of the handler is returned as json.
+func (browser *Browser) CallBridge(ctx context.Context, handler string, data interface{}) (string, error) {
+	if !browser.IsRunning() {
+		return "", ErrNotRunning
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not marshal data for handler %s", handler)
+	}
+	var evalStr = fmt.Sprintf("securedisplay._dispatch(%s, %s)", strconv.Quote(handler), strconv.Quote(string(dataBytes)))
+	var res *string
+	if err := browser.TasksContext(ctx,
+		chromedp.Tasks{
+			chromedp.Evaluate(evalStr, &res),
+		},
+	); err != nil {
+		var exp *runtime.ExceptionDetails
+		if errors.As(err, &exp) {
+			return "", &JSError{Function: handler, Details: exp}
+		}
+		return "", errors.Wrapf(err, "could not call bridge handler %s", handler)
+	}
+	if res != nil {
+		return *res, nil
+	}
+	return "", nil
+}
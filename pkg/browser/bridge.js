@@ -0,0 +1,34 @@
+// securedisplay bridge sdk
+// injected into every page by the display browser
+(function () {
+    if (window.securedisplay) {
+        return;
+    }
+    const binding = window.__securedisplayBridge;
+    const handlers = {};
+    window.securedisplay = {
+        // send a message to the display process: status, ended, error or interaction
+        emit: function (type, data) {
+            if (typeof binding !== "function") {
+                console.log("securedisplay bridge not available");
+                return;
+            }
+            binding(JSON.stringify({type: type, data: data === undefined ? null : data}));
+        },
+        // register a handler, which can be called by the display process
+        on: function (type, handler) {
+            handlers[type] = handler;
+        },
+        off: function (type) {
+            delete handlers[type];
+        },
+        _dispatch: function (type, dataJSON) {
+            const handler = handlers[type];
+            if (handler === undefined) {
+                throw new ReferenceError("no securedisplay handler for " + type);
+            }
+            const result = handler(JSON.parse(dataJSON));
+            return result === undefined ? null : JSON.stringify(result);
+        },
+    };
+})();
@@ -8,14 +8,19 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"emperror.dev/errors"
 	"github.com/chromedp/cdproto"
 	"github.com/chromedp/cdproto/css"
 	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/fetch"
 	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/cdproto/inspector"
 	"github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/performance"
 	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/cdproto/target"
 	"github.com/je4/utils/v2/pkg/zLogger"
@@ -34,44 +39,80 @@ import (
 type Browser struct {
 	allocCtx    context.Context
 	allocCancel context.CancelFunc
-	TaskCtx     context.Context
+	taskCtx     context.Context
 	taskCancel  context.CancelFunc
+	ctxMu       sync.RWMutex // protects the contexts, which are replaced by Startup and Close
 	browser     *chromedp.Browser
 	TempDir     string
 	opts        []chromedp.ExecAllocatorOption
 	log         zLogger.ZLogger
 	semAction   *semaphore.Weighted
 	browserLog  func(string, ...interface{})
+	// lastURL is written by Navigate and read by the watchdog
+	lastURL     atomic.Pointer[url.URL]
+	crashChan   chan struct{}
+	failures    atomic.Int32
+	bridgeFunc  bridgeFuncType
+	consoleFunc consoleFuncType
+	restartFunc func()
+	// navigationFilter blocks document requests, if set
+	navigationFilter navigationFilterType
+	interceptors     interceptors
+	tabs             tabs
+	// overlayURL is shown above the content of the active tab, if not nil
+	overlayURL atomic.Pointer[url.URL]
 }
 
+// DefaultTaskTimeout is used by calls without context
+const DefaultTaskTimeout = 30 * time.Second
+
 // MouseAction are mouse input event actions
 type MouseAction chromedp.Action
 
-func NewBrowser(execOptions map[string]interface{}, log zLogger.ZLogger, browserLogFunc func(string, ...interface{})) (*Browser, error) {
+// NewBrowser prepares chrome with the command line flags in execOptions. launch may be nil for the defaults.
+func NewBrowser(execOptions map[string]interface{}, launch *LaunchOptions, log zLogger.ZLogger, browserLogFunc func(string, ...interface{})) (*Browser, error) {
 	browser := &Browser{
 		log:        log,
 		semAction:  semaphore.NewWeighted(1),
 		browserLog: browserLogFunc,
+		crashChan:  make(chan struct{}, 1),
 	}
-	return browser, browser.Init(execOptions)
+	return browser, browser.Init(execOptions, launch)
 }
 
 func (browser *Browser) getTimeoutCtx(duration time.Duration) context.Context {
 	if duration == 0 {
 		duration = 10 * time.Second
 	}
-	newCtx, _ := context.WithTimeout(browser.TaskCtx, duration)
+	newCtx, _ := context.WithTimeout(browser.activeCtx(), duration)
 	return newCtx
 }
 
 func (browser *Browser) Startup() error {
 	// create the execution context
-	browser.allocCtx, browser.allocCancel = chromedp.NewExecAllocator(context.Background(), browser.opts...)
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), browser.opts...)
 
 	// also set up a custom logger
-	browser.TaskCtx, browser.taskCancel = chromedp.NewContext(browser.allocCtx, chromedp.WithLogf(zLogger.NewZWrapper(browser.log).Debugf))
+	taskCtx, taskCancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(zLogger.NewZWrapper(browser.log).Debugf))
+	browser.ctxMu.Lock()
+	browser.allocCtx, browser.allocCancel = allocCtx, allocCancel
+	browser.taskCtx, browser.taskCancel = taskCtx, taskCancel
+	browser.ctxMu.Unlock()
+
+	chromedp.ListenTarget(taskCtx, browser.listener(taskCtx))
+	return nil
+}
 
-	chromedp.ListenTarget(browser.TaskCtx, func(ev interface{}) {
+// taskContext returns the context of the main tab, nil if the browser is closed
+func (browser *Browser) taskContext() context.Context {
+	browser.ctxMu.RLock()
+	defer browser.ctxMu.RUnlock()
+	return browser.taskCtx
+}
+
+// listener receives the events of the tab with context ctx
+func (browser *Browser) listener(ctx context.Context) func(ev interface{}) {
+	return func(ev interface{}) {
 		switch ev := ev.(type) {
 		case *runtime.EventConsoleAPICalled:
 			str := fmt.Sprintf("%s - %s: ", ev.Timestamp.Time().Format(`2006-01-02T15:04:05`), ev.Type)
@@ -82,6 +123,20 @@ func (browser *Browser) Startup() error {
 				str += fmt.Sprintf("[%s]%s", arg.Type, arg.Value)
 			}
 			browser.browserLog(str)
+			browser.console(consoleLevel(ev.Type), consoleMessage(ev.Args))
+		case *runtime.EventExceptionThrown:
+			browser.browserLog(reflect.TypeOf(ev).String(), ev)
+			browser.console("error", ev.ExceptionDetails.Error())
+		case *runtime.EventBindingCalled:
+			browser.bridgeCalled(ctx, ev)
+		case *fetch.EventRequestPaused:
+			browser.requestPaused(ctx, ev)
+		case *inspector.EventTargetCrashed:
+			browser.log.Error().Msg("browser target crashed")
+			select {
+			case browser.crashChan <- struct{}{}:
+			default:
+			}
 		case *target.EventTargetDestroyed:
 		case *cdproto.Message:
 		case *target.EventTargetInfoChanged:
@@ -104,26 +159,32 @@ func (browser *Browser) Startup() error {
 		default:
 			browser.browserLog(reflect.TypeOf(ev).String(), ev)
 		}
-	})
-	return nil
+	}
 }
 
-func (browser *Browser) Init(execOptions map[string]interface{}) error {
-	var err error
-
-	// create a temporary directory
-	browser.TempDir, err = os.MkdirTemp("", "securedisplay")
-	if err != nil {
-		return errors.Wrap(err, "cannot create tempdir")
+func (browser *Browser) Init(execOptions map[string]interface{}, launch *LaunchOptions) error {
+	if err := browser.SetExecOptions(execOptions, launch); err != nil {
+		return err
 	}
+	return browser.Startup()
+}
 
-	// build browser options
-	browser.opts = append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserDataDir(browser.TempDir))
-	for name, value := range execOptions {
-		browser.opts = append(browser.opts, chromedp.Flag(name, value))
+// SetExecOptions sets the chrome flags and launch options. They are used on the next start of chrome, e.g. by Restart.
+func (browser *Browser) SetExecOptions(execOptions map[string]interface{}, launch *LaunchOptions) error {
+	if launch != nil && launch.UserDataDir != "" {
+		if err := os.MkdirAll(launch.UserDataDir, 0700); err != nil {
+			return errors.Wrapf(err, "cannot create user data dir %s", launch.UserDataDir)
+		}
+	} else if browser.TempDir == "" {
+		// create a temporary directory
+		tempDir, err := os.MkdirTemp("", "securedisplay")
+		if err != nil {
+			return errors.Wrap(err, "cannot create tempdir")
+		}
+		browser.TempDir = tempDir
 	}
-
-	return browser.Startup()
+	browser.opts = browser.allocatorOptions(execOptions, launch)
+	return nil
 }
 
 // fullScreenshot takes a screenshot of the entire browser viewport.
@@ -196,19 +257,31 @@ func (browser *Browser) Screenshot(width int, height int, sigma float64) ([]byte
 
 // checks whether browser is running. if not, clean up
 func (browser *Browser) IsRunning() bool {
-	if browser.TaskCtx == nil {
+	taskCtx := browser.taskContext()
+	if taskCtx == nil {
 		return false
 	}
-	if browser.TaskCtx.Err() != nil {
+	if taskCtx.Err() != nil {
 		browser.Close()
 		return false
 	}
 	return true
 }
 
+// Tasks runs the tasks with the default timeout
 func (browser *Browser) Tasks(tasks chromedp.Tasks) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTaskTimeout)
+	defer cancel()
+	return browser.TasksContext(ctx, tasks)
+}
+
+// TasksContext runs the tasks and returns the error of chromedp.
+// If ctx is done before the tasks are finished, they are cancelled.
+func (browser *Browser) TasksContext(ctx context.Context, tasks chromedp.Tasks) error {
 	// screenshot is resource intense. wait until done...
-	browser.semAction.Acquire(context.Background(), 1)
+	if err := browser.semAction.Acquire(ctx, 1); err != nil {
+		return errors.Wrap(err, "cannot acquire semaphore")
+	}
 	browser.log.Debug().Msgf("acquire semaphore")
 	defer func() {
 		browser.semAction.Release(1)
@@ -223,23 +296,22 @@ func (browser *Browser) Tasks(tasks chromedp.Tasks) error {
 			return errors.Wrap(err, "cannot re-start browser")
 		}
 	}
-	// run the task in background and return after task is done or timeoiut
-	c1 := make(chan bool, 1)
-	go func() {
-		browser.log.Debug().Msgf("tasks started")
-		if err := chromedp.Run(browser.TaskCtx, tasks); err != nil {
-			browser.log.Error().Msgf("error running task: %v", err)
-			c1 <- false
-			return
+	// the chromedp context must be derived from the tab context, cancel it together with ctx
+	runCtx, cancel := context.WithCancel(browser.activeCtx())
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	browser.log.Debug().Msgf("tasks started")
+	if err := chromedp.Run(runCtx, tasks); err != nil {
+		browser.failures.Add(1)
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "tasks cancelled")
 		}
-		c1 <- true
-	}()
-	select {
-	case res := <-c1:
-		browser.log.Debug().Msgf("tasks returned: %v", res)
-	case <-time.After(5 * time.Second):
-		browser.log.Debug().Msgf("tasks timed out")
+		return errors.Wrap(err, "error running tasks")
 	}
+	browser.failures.Store(0)
+	browser.log.Debug().Msgf("tasks done")
 	return nil
 }
 
@@ -248,7 +320,7 @@ func (browser *Browser) Run() error {
 	c1 := make(chan bool, 1)
 	go func() {
 		browser.log.Debug().Msgf("tasks started")
-		if err := chromedp.Run(browser.TaskCtx); err != nil {
+		if err := chromedp.Run(browser.taskContext(), browser.bridgeSetup(), browser.interceptionSetup()); err != nil {
 			browser.log.Error().Msgf("cannot start chrome: %v", err)
 			c1 <- false
 			return
@@ -268,6 +340,7 @@ func (browser *Browser) Close() {
 	// all paranoia...
 	browser.log.Debug().Msg("closing browser")
 
+	browser.ctxMu.Lock()
 	if browser.taskCancel != nil {
 		browser.taskCancel()
 		browser.taskCancel = nil
@@ -276,56 +349,36 @@ func (browser *Browser) Close() {
 		browser.allocCancel()
 		browser.allocCancel = nil
 	}
+	browser.taskCtx = nil
+	browser.ctxMu.Unlock()
+	browser.closeTabs()
 	if browser.TempDir != "" {
 		os.RemoveAll(browser.TempDir)
 	}
-	browser.TaskCtx = nil
 }
 
+// MouseClick clicks on the element or at position x/y if element is empty
 func (browser *Browser) MouseClick(waitVisible string, x, y int64, element string, timeout time.Duration) error {
-	// screenshot is resource intense. wait until done...
-	browser.semAction.Acquire(context.Background(), 1)
-	browser.log.Debug().Msgf("acquire semaphore")
-	defer func() {
-		browser.semAction.Release(1)
-		browser.log.Debug().Msgf("release semaphore")
-	}()
+	if timeout == 0 {
+		timeout = DefaultTaskTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return browser.MouseClickContext(ctx, waitVisible, x, y, element)
+}
 
-	if !browser.IsRunning() {
-		if err := browser.Startup(); err != nil {
-			return errors.Wrap(err, "cannot re-initialize browser")
-		}
-		if err := browser.Run(); err != nil {
-			return errors.Wrap(err, "cannot re-start browser")
-		}
+func (browser *Browser) MouseClickContext(ctx context.Context, waitVisible string, x, y int64, element string) error {
+	actions := chromedp.Tasks{}
+	if waitVisible != "" {
+		actions = append(actions, chromedp.WaitVisible(waitVisible, chromedp.ByQuery))
 	}
-	// run the task in background and return after task is done or timeoiut
-	c1 := make(chan bool, 1)
-	go func() {
-		browser.log.Debug().Msgf("mouseclick started")
-		actions := []chromedp.Action{}
-		if waitVisible != "" {
-			actions = append(actions, chromedp.WaitVisible(waitVisible, chromedp.ByQuery))
-		}
-		if element == "" {
-			actions = append(actions, MouseClickXYAction(float64(x), float64(y)))
-		} else {
-			actions = append(actions, chromedp.Click(element, chromedp.NodeVisible))
-		}
-		ctx, cancel := context.WithTimeout(browser.TaskCtx, timeout)
-		defer cancel()
-		if err := chromedp.Run(ctx, actions...); err != nil {
-			browser.log.Error().Msgf("error running mouseclick: %v", err)
-			c1 <- false
-			return
-		}
-		c1 <- true
-	}()
-	select {
-	case res := <-c1:
-		browser.log.Debug().Msgf("mousclick returned: %v", res)
-	case <-time.After(5 * time.Second):
-		browser.log.Debug().Msgf("mouseclick timed out")
+	if element == "" {
+		actions = append(actions, MouseClickXYAction(float64(x), float64(y)))
+	} else {
+		actions = append(actions, chromedp.Click(element, chromedp.NodeVisible))
+	}
+	if err := browser.TasksContext(ctx, actions); err != nil {
+		return errors.Wrap(err, "cannot run mouseclick")
 	}
 	return nil
 }
@@ -363,26 +416,55 @@ func MouseClickElementAction(element string, opts ...chromedp.MouseOption) Mouse
 }
 
 func (browser *Browser) Navigate(u *url.URL) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTaskTimeout)
+	defer cancel()
+	return browser.NavigateContext(ctx, u)
+}
+
+func (browser *Browser) NavigateContext(ctx context.Context, u *url.URL) error {
 	if !browser.IsRunning() {
 		if err := browser.Startup(); err != nil {
 			return errors.Wrap(err, "could not start browser")
 		}
 	}
 
+	if !browser.loadAllowed(u) {
+		return errors.Errorf("navigation to %s not allowed", u.String())
+	}
+	// show a preloaded tab instead of loading again
+	if name, ok := browser.tabWithURL(u); ok {
+		err := browser.ActivateTab(ctx, name)
+		if err == nil {
+			return nil
+		}
+		browser.log.Warn().Err(err).Msgf("cannot show preloaded %s, navigating", u.String())
+	}
+	active := browser.ActiveTab()
 	tasks := chromedp.Tasks{
 		chromedp.Navigate(u.String()),
 		chromedp.WaitReady("body"),
+		browser.overlayAction(),
 		//		browser.MouseClickXYAction(2,2),
 	}
-	if err := browser.Tasks(tasks); err != nil {
+	if err := browser.TasksContext(ctx, tasks); err != nil {
 		return errors.Wrapf(err, "could not navigate to %s", u.String())
 	}
+	browser.lastURL.Store(u)
+	browser.setTabURL(active, u)
 	return nil
 }
 
 func (browser *Browser) Evaluate(function string, param interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTaskTimeout)
+	defer cancel()
+	return browser.EvaluateContext(ctx, function, param)
+}
+
+// EvaluateContext calls the javascript function with the json encoded parameter.
+// Exceptions thrown by javascript are returned as *JSError
+func (browser *Browser) EvaluateContext(ctx context.Context, function string, param interface{}) (string, error) {
 	if !browser.IsRunning() {
-		return "", errors.New("could not evaluate function - browser is not running")
+		return "", ErrNotRunning
 	}
 	paramBytes, err := json.Marshal(param)
 	if err != nil {
@@ -390,11 +472,15 @@ func (browser *Browser) Evaluate(function string, param interface{}) (string, er
 	}
 	var evalStr = fmt.Sprintf("%s(%s)", function, strconv.Quote(string(paramBytes)))
 	var res *string
-	if err := browser.Tasks(
+	if err := browser.TasksContext(ctx,
 		chromedp.Tasks{
 			chromedp.Evaluate(evalStr, &res),
 		},
 	); err != nil {
+		var exp *runtime.ExceptionDetails
+		if errors.As(err, &exp) {
+			return "", &JSError{Function: function, Details: exp}
+		}
 		return "", errors.Wrapf(err, "could not evaluate function %s", function)
 	}
 	if res != nil {
@@ -402,3 +488,101 @@ func (browser *Browser) Evaluate(function string, param interface{}) (string, er
 	}
 	return "", nil
 }
+
+// LastURL returns the url of the last successful call to Navigate
+func (browser *Browser) LastURL() *url.URL {
+	return browser.lastURL.Load()
+}
+
+// Failures returns the number of consecutive failed tasks
+func (browser *Browser) Failures() int {
+	return int(browser.failures.Load())
+}
+
+// Crashed returns a channel, which receives a value if the page renderer crashed
+func (browser *Browser) Crashed() <-chan struct{} {
+	return browser.crashChan
+}
+
+// Heartbeat checks whether the page is responsive by evaluating a trivial javascript
+// expression within the given deadline
+func (browser *Browser) Heartbeat(deadline time.Duration) error {
+	taskCtx := browser.activeCtx()
+	if taskCtx == nil || taskCtx.Err() != nil {
+		return errors.New("browser not running")
+	}
+	ctx, cancel := context.WithTimeout(taskCtx, deadline)
+	defer cancel()
+	var res float64
+	if err := chromedp.Run(ctx, chromedp.Evaluate("Date.now()", &res)); err != nil {
+		return errors.Wrapf(err, "heartbeat failed")
+	}
+	return nil
+}
+
+// Metrics returns the chrome performance metrics of the page like JSHeapUsedSize or Nodes
+func (browser *Browser) Metrics(deadline time.Duration) (map[string]float64, error) {
+	taskCtx := browser.activeCtx()
+	if taskCtx == nil || taskCtx.Err() != nil {
+		return nil, errors.New("browser not running")
+	}
+	ctx, cancel := context.WithTimeout(taskCtx, deadline)
+	defer cancel()
+	var metrics []*performance.Metric
+	if err := chromedp.Run(ctx,
+		performance.Enable(),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			metrics, err = performance.GetMetrics().Do(ctx)
+			return err
+		}),
+	); err != nil {
+		return nil, errors.Wrap(err, "cannot get performance metrics")
+	}
+	var result = map[string]float64{}
+	for _, metric := range metrics {
+		result[metric.Name] = metric.Value
+	}
+	return result, nil
+}
+
+// OnRestart sets a function, which is called after chrome is restarted and before the last url is loaded again
+func (browser *Browser) OnRestart(restartFunc func()) {
+	browser.restartFunc = restartFunc
+}
+
+// Restart shuts down chrome, starts a new instance and navigates to the last url
+func (browser *Browser) Restart() error {
+	if err := browser.semAction.Acquire(context.Background(), 1); err != nil {
+		return errors.Wrap(err, "cannot acquire semaphore")
+	}
+	browser.log.Debug().Msgf("acquire semaphore")
+	browser.Close()
+	// remove stale crash notification
+	select {
+	case <-browser.crashChan:
+	default:
+	}
+	browser.failures.Store(0)
+	if err := browser.Startup(); err != nil {
+		browser.semAction.Release(1)
+		return errors.Wrap(err, "cannot re-initialize browser")
+	}
+	if err := browser.Run(); err != nil {
+		browser.semAction.Release(1)
+		return errors.Wrap(err, "cannot re-start browser")
+	}
+	browser.semAction.Release(1)
+	browser.log.Debug().Msgf("release semaphore")
+	if browser.restartFunc != nil {
+		browser.restartFunc()
+	}
+	lastURL := browser.lastURL.Load()
+	if lastURL == nil {
+		return nil
+	}
+	if err := browser.Navigate(lastURL); err != nil {
+		return errors.Wrapf(err, "cannot navigate to %s", lastURL.String())
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package browser
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// TestTaskContext replaces the context of the main tab while it is read like by the watchdog.
+// chrome is not started, the race detector checks the access.
+func TestTaskContext(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	browser, err := NewBrowser(map[string]interface{}{}, nil, logger, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatalf("cannot create browser: %v", err)
+	}
+	defer browser.Close()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			browser.IsRunning()
+			browser.activeCtx()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		browser.Close()
+		if err := browser.Startup(); err != nil {
+			t.Fatalf("cannot start browser: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if !browser.IsRunning() {
+		t.Fatal("browser context not running after startup")
+	}
+}
@@ -0,0 +1,60 @@
+package browser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+type consoleFuncType func(level string, message string)
+
+// OnConsole sets the function, which receives the console messages and uncaught exceptions of the pages.
+// level is a zerolog level name.
+func (browser *Browser) OnConsole(consoleFunc func(level string, message string)) {
+	browser.consoleFunc = consoleFunc
+}
+
+func (browser *Browser) console(level string, message string) {
+	if browser.consoleFunc != nil {
+		browser.consoleFunc(level, message)
+	}
+}
+
+// consoleLevel maps the console api call to a zerolog level name
+func consoleLevel(t runtime.APIType) string {
+	switch t {
+	case runtime.APITypeError, runtime.APITypeAssert:
+		return "error"
+	case runtime.APITypeWarning:
+		return "warn"
+	case runtime.APITypeDebug:
+		return "debug"
+	case runtime.APITypeTrace:
+		return "trace"
+	default:
+		return "info"
+	}
+}
+
+// consoleMessage joins the arguments of a console call
+func consoleMessage(args []*runtime.RemoteObject) string {
+	var parts = []string{}
+	for _, arg := range args {
+		switch {
+		case arg.Type == runtime.TypeString:
+			str, err := strconv.Unquote(string(arg.Value))
+			if err != nil {
+				str = string(arg.Value)
+			}
+			parts = append(parts, str)
+		case len(arg.Value) > 0:
+			parts = append(parts, string(arg.Value))
+		case arg.Description != "":
+			parts = append(parts, arg.Description)
+		default:
+			parts = append(parts, string(arg.Type))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,44 @@
+package browser
+
+import (
+	"fmt"
+
+	"emperror.dev/errors"
+	"github.com/chromedp/cdproto/runtime"
+)
+
+var ErrNotRunning = errors.New("browser is not running")
+
+// JSError is returned if an evaluated javascript function throws an exception
+type JSError struct {
+	Function string
+	Details  *runtime.ExceptionDetails
+}
+
+func (e *JSError) Error() string {
+	return fmt.Sprintf("javascript exception in %s: %v", e.Function, e.Details)
+}
+
+func (e *JSError) Unwrap() error {
+	return e.Details
+}
+
+// ClassName returns the class of the thrown javascript object (i.e. "ReferenceError")
+func (e *JSError) ClassName() string {
+	if e.Details == nil || e.Details.Exception == nil {
+		return ""
+	}
+	return e.Details.Exception.ClassName
+}
+
+// IsPageNotReady checks whether err results from a function not (yet) defined in the page
+func IsPageNotReady(err error) bool {
+	if errors.Is(err, ErrNotRunning) {
+		return true
+	}
+	var jsErr *JSError
+	if errors.As(err, &jsErr) {
+		return jsErr.ClassName() == "ReferenceError"
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// InterceptedRequest is a paused request of the browser
+type InterceptedRequest struct {
+	URL          string
+	Method       string
+	Headers      map[string]string
+	ResourceType network.ResourceType
+}
+
+// InterceptAction is the decision of a RequestHandler. A nil action continues the request unchanged.
+type InterceptAction struct {
+	block   bool
+	url     string
+	headers map[string]string
+	fulfill *fulfillResponse
+}
+
+type fulfillResponse struct {
+	status  int
+	headers map[string]string
+	body    []byte
+}
+
+// BlockRequest fails the request
+func BlockRequest() *InterceptAction {
+	return &InterceptAction{block: true}
+}
+
+// RewriteURL sends the request to another url. The page does not see the change.
+func RewriteURL(u string) *InterceptAction {
+	return &InterceptAction{url: u}
+}
+
+// SetHeaders adds or replaces request headers
+func SetHeaders(headers map[string]string) *InterceptAction {
+	return &InterceptAction{headers: headers}
+}
+
+// FulfillRequest answers the request without network access
+func FulfillRequest(status int, headers map[string]string, body []byte) *InterceptAction {
+	return &InterceptAction{fulfill: &fulfillResponse{status: status, headers: headers, body: body}}
+}
+
+// RequestHandler decides about an intercepted request
+type RequestHandler func(req *InterceptedRequest) *InterceptAction
+
+type interceptor struct {
+	id           int
+	pattern      string
+	re           *regexp.Regexp
+	resourceType network.ResourceType
+	handler      RequestHandler
+}
+
+// interceptors are the registered request handlers of a browser
+type interceptors struct {
+	sync.RWMutex
+	list   []*interceptor
+	nextID int
+}
+
+// patternRegexp converts a CDP url pattern ('*' zero or more, '?' exactly one character) to a regexp
+func patternRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			sb.WriteString(".*")
+		case r == '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	return re, errors.Wrapf(err, "invalid url pattern %s", pattern)
+}
+
+// Intercept registers a handler for all requests matching the url pattern ('*' and '?' wildcards)
+// and resource type (empty for all types). Handlers are called in the order of registration.
+// Blocking and fulfilling handlers end the chain, url rewrites and headers are combined.
+// The returned id removes the handler with RemoveInterceptor.
+func (browser *Browser) Intercept(pattern string, resourceType network.ResourceType, handler RequestHandler) (int, error) {
+	re, err := patternRegexp(pattern)
+	if err != nil {
+		return 0, err
+	}
+	browser.interceptors.Lock()
+	browser.interceptors.nextID++
+	id := browser.interceptors.nextID
+	browser.interceptors.list = append(browser.interceptors.list, &interceptor{
+		id:           id,
+		pattern:      pattern,
+		re:           re,
+		resourceType: resourceType,
+		handler:      handler,
+	})
+	browser.interceptors.Unlock()
+	return id, browser.updateInterception()
+}
+
+// RemoveInterceptor removes the handler with the id returned by Intercept
+func (browser *Browser) RemoveInterceptor(id int) error {
+	browser.interceptors.Lock()
+	browser.interceptors.list = slices.DeleteFunc(browser.interceptors.list, func(i *interceptor) bool {
+		return i.id == id
+	})
+	browser.interceptors.Unlock()
+	return browser.updateInterception()
+}
+
+// updateInterception applies the patterns to a running browser. Otherwise they are applied by Run.
+func (browser *Browser) updateInterception() error {
+	if !browser.IsRunning() {
+		return nil
+	}
+	taskCtx := browser.taskContext()
+	if c := chromedp.FromContext(taskCtx); c == nil || c.Browser == nil {
+		return nil
+	}
+	if err := chromedp.Run(taskCtx, browser.interceptionSetup()); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, t := range browser.tabs.list() {
+		if err := chromedp.Run(t.ctx, browser.interceptionSetup()); err != nil {
+			return errors.Wrapf(err, "cannot update interception of tab %s", t.name)
+		}
+	}
+	return nil
+}
+
+// interceptionSetup enables the interception for the patterns of all handlers
+func (browser *Browser) interceptionSetup() chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		browser.interceptors.RLock()
+		var patterns = []*fetch.RequestPattern{}
+		for _, i := range browser.interceptors.list {
+			patterns = append(patterns, &fetch.RequestPattern{
+				URLPattern:   i.pattern,
+				ResourceType: i.resourceType,
+				RequestStage: fetch.RequestStageRequest,
+			})
+		}
+		browser.interceptors.RUnlock()
+		if len(patterns) == 0 {
+			return errors.Wrap(fetch.Disable().Do(ctx), "cannot disable request interception")
+		}
+		return errors.Wrap(fetch.Enable().WithPatterns(patterns).Do(ctx), "cannot enable request interception")
+	})
+}
+
+// decide calls the matching handlers for a request
+func (browser *Browser) decide(req *InterceptedRequest) *InterceptAction {
+	browser.interceptors.RLock()
+	list := slices.Clone(browser.interceptors.list)
+	browser.interceptors.RUnlock()
+	var result = &InterceptAction{headers: map[string]string{}}
+	for _, i := range list {
+		if (i.resourceType != "" && i.resourceType != req.ResourceType) || !i.re.MatchString(req.URL) {
+			continue
+		}
+		action := i.handler(req)
+		if action == nil {
+			continue
+		}
+		if action.block || action.fulfill != nil {
+			return action
+		}
+		if action.url != "" && result.url == "" {
+			result.url = action.url
+		}
+		for name, value := range action.headers {
+			result.headers[name] = value
+		}
+	}
+	return result
+}
+
+func (browser *Browser) requestPaused(ctx context.Context, ev *fetch.EventRequestPaused) {
+	// do not block the event listener of chromedp
+	go func() {
+		req := &InterceptedRequest{
+			URL:          ev.Request.URL,
+			Method:       ev.Request.Method,
+			Headers:      map[string]string{},
+			ResourceType: ev.ResourceType,
+		}
+		for name, value := range ev.Request.Headers {
+			req.Headers[name] = fmt.Sprint(value)
+		}
+		action := browser.decide(req)
+		var cdpAction chromedp.Action
+		switch {
+		case action.block:
+			browser.log.Debug().Msgf("request %s blocked", req.URL)
+			cdpAction = fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient)
+		case action.fulfill != nil:
+			var headers = []*fetch.HeaderEntry{}
+			for name, value := range action.fulfill.headers {
+				headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+			}
+			cdpAction = fetch.FulfillRequest(ev.RequestID, int64(action.fulfill.status)).
+				WithResponseHeaders(headers).
+				WithBody(base64.StdEncoding.EncodeToString(action.fulfill.body))
+		default:
+			continueAction := fetch.ContinueRequest(ev.RequestID)
+			if action.url != "" {
+				continueAction = continueAction.WithURL(action.url)
+			}
+			if len(action.headers) > 0 {
+				for name, value := range action.headers {
+					// header names are case-insensitive
+					for old := range req.Headers {
+						if strings.EqualFold(old, name) {
+							delete(req.Headers, old)
+						}
+					}
+					req.Headers[name] = value
+				}
+				var headers = []*fetch.HeaderEntry{}
+				for name, value := range req.Headers {
+					headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+				}
+				continueAction = continueAction.WithHeaders(headers)
+			}
+			cdpAction = continueAction
+		}
+		if err := chromedp.Run(ctx, cdpAction); err != nil {
+			browser.log.Error().Err(err).Msgf("cannot resume request %s", req.URL)
+		}
+	}()
+}
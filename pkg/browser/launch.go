@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+// LaunchOptions configure the chrome process besides the command line flags
+type LaunchOptions struct {
+	// ExecPath is the chrome binary, empty searches the default locations
+	ExecPath string
+	// UserDataDir keeps the profile between starts. Empty uses a temporary folder, which is removed on close.
+	UserDataDir string
+	// Env are additional environment variables like DISPLAY=:0.1
+	Env []string
+	// Extensions are folders of unpacked extensions
+	Extensions []string
+}
+
+// allocatorOptions combines the chromedp defaults, the launch options and the flags. Flags override everything else.
+func (browser *Browser) allocatorOptions(execOptions map[string]interface{}, launch *LaunchOptions) []chromedp.ExecAllocatorOption {
+	if launch == nil {
+		launch = &LaunchOptions{}
+	}
+	userDataDir := browser.TempDir
+	if launch.UserDataDir != "" {
+		userDataDir = launch.UserDataDir
+	}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserDataDir(userDataDir))
+	if launch.ExecPath != "" {
+		opts = append(opts, chromedp.ExecPath(launch.ExecPath))
+	}
+	if len(launch.Env) > 0 {
+		opts = append(opts, chromedp.Env(launch.Env...))
+	}
+	if len(launch.Extensions) > 0 {
+		extensions := strings.Join(launch.Extensions, ",")
+		opts = append(opts,
+			// enabled by the chromedp defaults
+			chromedp.Flag("disable-extensions", false),
+			chromedp.Flag("load-extension", extensions),
+			chromedp.Flag("disable-extensions-except", extensions),
+		)
+	}
+	for name, value := range execOptions {
+		opts = append(opts, chromedp.Flag(name, value))
+	}
+	return opts
+}
@@ -0,0 +1,47 @@
+package browser
+
+import (
+	"net/url"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+type navigationFilterType func(u *url.URL) bool
+
+// SetNavigationFilter blocks all document requests of the browser, for which allow returns false
+func (browser *Browser) SetNavigationFilter(allow func(u *url.URL) bool) error {
+	browser.navigationFilter = allow
+	_, err := browser.Intercept("*", network.ResourceTypeDocument, func(req *InterceptedRequest) *InterceptAction {
+		if browser.navigationAllowed(req.URL) {
+			return nil
+		}
+		browser.log.Warn().Msgf("navigation to %s blocked", req.URL)
+		return BlockRequest()
+	})
+	return err
+}
+
+// navigationAllowed checks the document requests of the pages. Besides the filter only about:blank is
+// allowed, other internal pages and data urls could show any content.
+func (browser *Browser) navigationAllowed(rawURL string) bool {
+	if browser.navigationFilter == nil {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "about" && u.Opaque == "blank" {
+		return true
+	}
+	return browser.navigationFilter(u)
+}
+
+// loadAllowed checks the urls loaded by the display. Its data urls are rendered by the display itself,
+// like the emergency page, the urls of events are checked by the content policy before.
+func (browser *Browser) loadAllowed(u *url.URL) bool {
+	if u.Scheme == "data" {
+		return true
+	}
+	return browser.navigationAllowed(u.String())
+}
@@ -0,0 +1,46 @@
+package browser
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNavigationAllowed(t *testing.T) {
+	browser := &Browser{navigationFilter: func(u *url.URL) bool { return u.Host == "content.example.com" }}
+	for _, test := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://content.example.com/video.html", true},
+		{"https://other.example.com/", false},
+		{"about:blank", true},
+		{"about:config", false},
+		{"data:text/html,<h1>escaped</h1>", false},
+		{"javascript:alert(1)", false},
+	} {
+		if allowed := browser.navigationAllowed(test.url); allowed != test.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", test.url, test.allowed, allowed)
+		}
+	}
+}
+
+func TestLoadAllowed(t *testing.T) {
+	browser := &Browser{navigationFilter: func(u *url.URL) bool { return u.Host == "content.example.com" }}
+	for _, test := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://content.example.com/video.html", true},
+		{"https://other.example.com/", false},
+		{"data:text/html;charset=utf-8;base64,PGgxPmVtZXJnZW5jeTwvaDE+", true},
+		{"about:config", false},
+	} {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %v", test.url, err)
+		}
+		if allowed := browser.loadAllowed(u); allowed != test.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", test.url, test.allowed, allowed)
+		}
+	}
+}
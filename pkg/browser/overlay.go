@@ -0,0 +1,65 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"emperror.dev/errors"
+	"github.com/chromedp/chromedp"
+)
+
+// overlayScript adds, updates or removes (empty url) a transparent iframe above the page
+const overlayScript = `(function(u) {
+	var f = document.getElementById('__securedisplayOverlay');
+	if (!u) {
+		if (f) f.remove();
+		return;
+	}
+	if (!f) {
+		f = document.createElement('iframe');
+		f.id = '__securedisplayOverlay';
+		f.setAttribute('allowtransparency', 'true');
+		f.style.cssText = 'position:fixed;inset:0;width:100vw;height:100vh;border:0;background:transparent;z-index:2147483647;pointer-events:none';
+		document.documentElement.appendChild(f);
+	}
+	if (f.src !== u) f.src = u;
+})(%s)`
+
+// overlayAction applies the current overlay to the page
+func (browser *Browser) overlayAction() chromedp.Action {
+	var u string
+	if overlayURL := browser.overlayURL.Load(); overlayURL != nil {
+		u = overlayURL.String()
+	}
+	data, _ := json.Marshal(u)
+	return chromedp.Evaluate(fmt.Sprintf(overlayScript, string(data)), nil)
+}
+
+// ShowOverlay shows the page u above the content (e.g. ticker or emergency message).
+// The overlay does not receive input and stays on navigation and tab changes.
+func (browser *Browser) ShowOverlay(ctx context.Context, u *url.URL) error {
+	if !browser.loadAllowed(u) {
+		return errors.Errorf("overlay %s not allowed", u.String())
+	}
+	browser.overlayURL.Store(u)
+	if err := browser.TasksContext(ctx, chromedp.Tasks{browser.overlayAction()}); err != nil {
+		return errors.Wrapf(err, "cannot show overlay %s", u.String())
+	}
+	return nil
+}
+
+// HideOverlay removes the overlay
+func (browser *Browser) HideOverlay(ctx context.Context) error {
+	browser.overlayURL.Store(nil)
+	if err := browser.TasksContext(ctx, chromedp.Tasks{browser.overlayAction()}); err != nil {
+		return errors.Wrap(err, "cannot hide overlay")
+	}
+	return nil
+}
+
+// Overlay returns the url of the visible overlay or nil
+func (browser *Browser) Overlay() *url.URL {
+	return browser.overlayURL.Load()
+}
@@ -0,0 +1,264 @@
+package browser
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// MainTab is the name of the tab created with the browser
+const MainTab = "main"
+
+type tab struct {
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	url    *url.URL
+}
+
+// tabs are the additional tabs of a browser. The main tab uses taskCtx.
+type tabs struct {
+	sync.Mutex
+	byName  map[string]*tab
+	active  string
+	mainURL *url.URL
+}
+
+func (t *tabs) list() []*tab {
+	t.Lock()
+	defer t.Unlock()
+	var result = []*tab{}
+	for _, tb := range t.byName {
+		result = append(result, tb)
+	}
+	return result
+}
+
+// activeCtx returns the context of the visible tab
+func (browser *Browser) activeCtx() context.Context {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	if tb, ok := browser.tabs.byName[browser.tabs.active]; ok {
+		return tb.ctx
+	}
+	return browser.taskContext()
+}
+
+// tabCtx returns the context of the named tab
+func (browser *Browser) tabCtx(name string) (context.Context, error) {
+	if name == MainTab {
+		return browser.taskContext(), nil
+	}
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	tb, ok := browser.tabs.byName[name]
+	if !ok {
+		return nil, errors.Errorf("tab %s not found", name)
+	}
+	return tb.ctx, nil
+}
+
+// setTabURL remembers the url loaded in the named tab
+func (browser *Browser) setTabURL(name string, u *url.URL) {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	if name == MainTab {
+		browser.tabs.mainURL = u
+		return
+	}
+	if tb, ok := browser.tabs.byName[name]; ok {
+		tb.url = u
+	}
+}
+
+// tabWithURL returns the name of a background tab, which has u loaded
+func (browser *Browser) tabWithURL(u *url.URL) (string, bool) {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	active := browser.activeTab()
+	if active != MainTab && browser.tabs.mainURL != nil && browser.tabs.mainURL.String() == u.String() {
+		return MainTab, true
+	}
+	for name, tb := range browser.tabs.byName {
+		if name != active && tb.url != nil && tb.url.String() == u.String() {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// activeTab returns the name of the visible tab. tabs must be locked by the caller.
+func (browser *Browser) activeTab() string {
+	if _, ok := browser.tabs.byName[browser.tabs.active]; ok {
+		return browser.tabs.active
+	}
+	return MainTab
+}
+
+// ActiveTab returns the name of the visible tab
+func (browser *Browser) ActiveTab() string {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	return browser.activeTab()
+}
+
+// Tabs returns the names of all tabs
+func (browser *Browser) Tabs() []string {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	var names = []string{}
+	for name := range browser.tabs.byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return append([]string{MainTab}, names...)
+}
+
+// NewTab opens a tab in the background. It gets the bridge and the request interception of the main tab.
+func (browser *Browser) NewTab(name string) error {
+	if name == "" || name == MainTab {
+		return errors.Errorf("invalid tab name '%s'", name)
+	}
+	if !browser.IsRunning() {
+		return ErrNotRunning
+	}
+	browser.tabs.Lock()
+	_, ok := browser.tabs.byName[name]
+	browser.tabs.Unlock()
+	if ok {
+		return errors.Errorf("tab %s already exists", name)
+	}
+	ctx, cancel := chromedp.NewContext(browser.taskContext())
+	chromedp.ListenTarget(ctx, browser.listener(ctx))
+	// the first run creates the target and must not use a derived context
+	if err := chromedp.Run(ctx, browser.bridgeSetup(), browser.interceptionSetup()); err != nil {
+		cancel()
+		return errors.Wrapf(err, "cannot create tab %s", name)
+	}
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	if _, ok := browser.tabs.byName[name]; ok {
+		cancel()
+		return errors.Errorf("tab %s already exists", name)
+	}
+	if browser.tabs.byName == nil {
+		browser.tabs.byName = make(map[string]*tab)
+	}
+	browser.tabs.byName[name] = &tab{name: name, ctx: ctx, cancel: cancel}
+	browser.log.Debug().Msgf("tab %s created", name)
+	return nil
+}
+
+// CloseTab closes a tab. If it is visible, the main tab is activated before.
+func (browser *Browser) CloseTab(name string) error {
+	if name == MainTab {
+		return errors.New("cannot close main tab")
+	}
+	if browser.ActiveTab() == name {
+		if err := browser.ActivateTab(context.Background(), MainTab); err != nil {
+			return errors.Wrapf(err, "cannot leave tab %s", name)
+		}
+	}
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	tb, ok := browser.tabs.byName[name]
+	if !ok {
+		return errors.Errorf("tab %s not found", name)
+	}
+	tb.cancel()
+	delete(browser.tabs.byName, name)
+	return nil
+}
+
+// closeTabs drops all tabs, their targets are closed with taskCtx
+func (browser *Browser) closeTabs() {
+	browser.tabs.Lock()
+	defer browser.tabs.Unlock()
+	for _, tb := range browser.tabs.byName {
+		tb.cancel()
+	}
+	browser.tabs.byName = nil
+	browser.tabs.active = ""
+	browser.tabs.mainURL = nil
+}
+
+// PreloadContext loads u into a background tab, which is created if needed.
+// A later Navigate to the same url shows the tab instead of loading the page again.
+func (browser *Browser) PreloadContext(ctx context.Context, name string, u *url.URL) error {
+	if !browser.loadAllowed(u) {
+		return errors.Errorf("navigation to %s not allowed", u.String())
+	}
+	if browser.ActiveTab() == name {
+		return errors.Errorf("cannot preload into visible tab %s", name)
+	}
+	if name != MainTab {
+		browser.tabs.Lock()
+		_, ok := browser.tabs.byName[name]
+		browser.tabs.Unlock()
+		if !ok {
+			if err := browser.NewTab(name); err != nil {
+				return err
+			}
+		}
+	}
+	tabCtx, err := browser.tabCtx(name)
+	if err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancel(tabCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	browser.setTabURL(name, nil)
+	if err := chromedp.Run(runCtx, chromedp.Navigate(u.String()), chromedp.WaitReady("body")); err != nil {
+		return errors.Wrapf(err, "cannot preload %s into tab %s", u.String(), name)
+	}
+	browser.setTabURL(name, u)
+	browser.log.Debug().Msgf("%s preloaded into tab %s", u.String(), name)
+	return nil
+}
+
+// ActivateTab brings the named tab to the front. The previous tab is emptied to stop its media.
+func (browser *Browser) ActivateTab(ctx context.Context, name string) error {
+	previous := browser.ActiveTab()
+	if previous == name {
+		return nil
+	}
+	tabCtx, err := browser.tabCtx(name)
+	if err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancel(tabCtx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	if err := chromedp.Run(runCtx, page.BringToFront(), browser.overlayAction()); err != nil {
+		return errors.Wrapf(err, "cannot activate tab %s", name)
+	}
+	browser.tabs.Lock()
+	browser.tabs.active = name
+	var u = browser.tabs.mainURL
+	if tb, ok := browser.tabs.byName[name]; ok {
+		u = tb.url
+	}
+	browser.tabs.Unlock()
+	if u != nil {
+		browser.lastURL.Store(u)
+	}
+	browser.log.Debug().Msgf("tab %s activated", name)
+
+	if previousCtx, err := browser.tabCtx(previous); err == nil {
+		browser.setTabURL(previous, nil)
+		blankCtx, cancel := context.WithTimeout(previousCtx, DefaultTaskTimeout)
+		defer cancel()
+		if err := chromedp.Run(blankCtx, chromedp.Navigate("about:blank")); err != nil {
+			browser.log.Warn().Err(err).Msgf("cannot empty tab %s", previous)
+		}
+	}
+	return nil
+}
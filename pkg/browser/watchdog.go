@@ -0,0 +1,169 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+type RecoveryReason string
+
+const (
+	RecoveryProcessExit      RecoveryReason = "process-exit"
+	RecoveryTargetCrashed    RecoveryReason = "target-crashed"
+	RecoveryHeartbeatTimeout RecoveryReason = "heartbeat-timeout"
+	RecoveryTaskFailures     RecoveryReason = "task-failures"
+)
+
+// Recovery describes a browser restart done by the watchdog
+type Recovery struct {
+	Reason  RecoveryReason `json:"reason"`
+	Error   string         `json:"error,omitempty"`
+	URL     string         `json:"url,omitempty"`
+	Attempt int            `json:"attempt"`
+	Success bool           `json:"success"`
+	Time    time.Time      `json:"time"`
+}
+
+func (r *Recovery) String() string {
+	jsonBytes, _ := json.Marshal(r)
+	return string(jsonBytes)
+}
+
+func (r *Recovery) Type() event.EventType {
+	return event.TypeBrowserRecovery
+}
+
+var _ event.DataInterface = (*Recovery)(nil)
+
+// NewWatchdog creates a supervisor for the browser. Every interval the page gets a heartbeat,
+// which must return within deadline. After maxFailures consecutive failed tasks the browser
+// is restarted as well. Every recovery is reported via the report function.
+func NewWatchdog(browser *Browser, interval, deadline time.Duration, maxFailures int, report func(*Recovery), logger zLogger.ZLogger) *Watchdog {
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	if deadline == 0 {
+		deadline = 5 * time.Second
+	}
+	if maxFailures == 0 {
+		maxFailures = 3
+	}
+	return &Watchdog{
+		browser:     browser,
+		interval:    interval,
+		deadline:    deadline,
+		maxFailures: maxFailures,
+		report:      report,
+		logger:      logger,
+		closeChan:   make(chan struct{}),
+	}
+}
+
+type Watchdog struct {
+	browser     *Browser
+	interval    time.Duration
+	deadline    time.Duration
+	maxFailures int
+	report      func(*Recovery)
+	logger      zLogger.ZLogger
+	closeChan   chan struct{}
+	wg          sync.WaitGroup
+	attempt     int
+}
+
+func (w *Watchdog) Start() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+func (w *Watchdog) Stop() {
+	close(w.closeChan)
+	w.wg.Wait()
+}
+
+func (w *Watchdog) run() {
+	defer w.wg.Done()
+	for {
+		var done <-chan struct{}
+		taskCtx := w.browser.taskContext()
+		if taskCtx != nil {
+			done = taskCtx.Done()
+		}
+		select {
+		case <-w.closeChan:
+			return
+		case <-done:
+			// do not restart, if the browser is shut down intentionally
+			select {
+			case <-w.closeChan:
+				return
+			default:
+			}
+			// do not restart, if the browser was restarted by a command or reload
+			if err := w.browser.semAction.Acquire(context.Background(), 1); err != nil {
+				w.logger.Error().Err(err).Msg("cannot acquire semaphore")
+				continue
+			}
+			restarted := w.browser.taskContext() != taskCtx && w.browser.IsRunning()
+			w.browser.semAction.Release(1)
+			if restarted {
+				continue
+			}
+			w.recover(RecoveryProcessExit, errors.New("chrome process exited"))
+		case <-w.browser.Crashed():
+			w.recover(RecoveryTargetCrashed, errors.New("renderer crashed"))
+		case <-time.After(w.interval):
+			if err := w.browser.Heartbeat(w.deadline); err != nil {
+				w.recover(RecoveryHeartbeatTimeout, err)
+				continue
+			}
+			if failures := w.browser.Failures(); failures >= w.maxFailures {
+				w.recover(RecoveryTaskFailures, errors.Errorf("%d consecutive task failures", failures))
+				continue
+			}
+			w.attempt = 0
+		}
+	}
+}
+
+func (w *Watchdog) recover(reason RecoveryReason, cause error) {
+	w.attempt++
+	// back off on repeated failures
+	if w.attempt > 1 {
+		backoff := time.Duration(w.attempt-1) * w.interval
+		if backoff > time.Minute {
+			backoff = time.Minute
+		}
+		select {
+		case <-w.closeChan:
+			return
+		case <-time.After(backoff):
+		}
+	}
+	w.logger.Warn().Err(cause).Msgf("browser watchdog: %s - restarting browser (attempt %d)", reason, w.attempt)
+	rec := &Recovery{
+		Reason:  reason,
+		Attempt: w.attempt,
+		Time:    time.Now(),
+	}
+	if u := w.browser.LastURL(); u != nil {
+		rec.URL = u.String()
+	}
+	if err := w.browser.Restart(); err != nil {
+		w.logger.Error().Err(err).Msg("browser watchdog: cannot restart browser")
+		rec.Error = fmt.Sprintf("%v: %v", cause, err)
+	} else {
+		rec.Error = cause.Error()
+		rec.Success = true
+	}
+	if w.report != nil {
+		w.report(rec)
+	}
+}
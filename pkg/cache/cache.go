@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+const indexFile = "index.json"
+
+// Entry is a cached content file
+type Entry struct {
+	URL         string    `json:"url"`
+	File        string    `json:"file"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	ContentType string    `json:"contentType"`
+	Fetched     time.Time `json:"fetched"`
+	LastUsed    time.Time `json:"lastUsed"`
+}
+
+// NewCache opens the content cache in dir. maxSize is the maximum size of all files in bytes.
+func NewCache(dir string, maxSize int64, client *http.Client, logger zLogger.ZLogger) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "cannot create cache folder %s", dir)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &Cache{
+		dir:      dir,
+		maxSize:  maxSize,
+		client:   client,
+		logger:   logger,
+		entries:  make(map[string]*Entry),
+		inFlight: make(map[string]chan struct{}),
+	}
+	if err := c.loadIndex(); err != nil {
+		return nil, errors.Wrapf(err, "cannot load cache index of %s", dir)
+	}
+	return c, nil
+}
+
+// Cache stores content files on disk
+type Cache struct {
+	dir       string
+	maxSize   int64
+	client    *http.Client
+	logger    zLogger.ZLogger
+	entries   map[string]*Entry
+	entriesMu sync.Mutex
+	inFlight  map[string]chan struct{}
+}
+
+func (c *Cache) loadIndex() error {
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	var entries = []*Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return errors.Wrap(err, "cannot unmarshal index")
+	}
+	for _, entry := range entries {
+		fi, err := os.Stat(filepath.Join(c.dir, entry.File))
+		if err != nil || fi.Size() != entry.Size {
+			c.logger.Warn().Msgf("dropping invalid cache entry %s", entry.URL)
+			continue
+		}
+		c.entries[entry.URL] = entry
+	}
+	return nil
+}
+
+// saveIndex writes the index. entriesMu must be held by the caller.
+func (c *Cache) saveIndex() error {
+	var entries = []*Entry{}
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal index")
+	}
+	tmp := filepath.Join(c.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "cannot write %s", tmp)
+	}
+	return errors.WithStack(os.Rename(tmp, filepath.Join(c.dir, indexFile)))
+}
+
+func fileName(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the entry of a cached url
+func (c *Cache) Get(u string) (*Entry, bool) {
+	c.entriesMu.Lock()
+	defer c.entriesMu.Unlock()
+	entry, ok := c.entries[u]
+	if !ok {
+		return nil, false
+	}
+	entry.LastUsed = time.Now()
+	e := *entry
+	return &e, true
+}
+
+// Entries returns a copy of all cache entries
+func (c *Cache) Entries() []*Entry {
+	c.entriesMu.Lock()
+	defer c.entriesMu.Unlock()
+	var result = []*Entry{}
+	for _, entry := range c.entries {
+		e := *entry
+		result = append(result, &e)
+	}
+	return result
+}
+
+// Prefetch downloads u into the cache. If checksum (sha256 hex) is not empty, the content is verified.
+// Concurrent calls for the same url wait for the running download.
+func (c *Cache) Prefetch(ctx context.Context, u string, checksum string) error {
+	checksum = strings.ToLower(checksum)
+	c.entriesMu.Lock()
+	if entry, ok := c.entries[u]; ok && (checksum == "" || entry.Checksum == checksum) {
+		c.entriesMu.Unlock()
+		return nil
+	}
+	if wait, ok := c.inFlight[u]; ok {
+		c.entriesMu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+		if _, ok := c.Get(u); !ok {
+			return errors.Errorf("download of %s failed", u)
+		}
+		return nil
+	}
+	done := make(chan struct{})
+	c.inFlight[u] = done
+	c.entriesMu.Unlock()
+	defer func() {
+		c.entriesMu.Lock()
+		delete(c.inFlight, u)
+		c.entriesMu.Unlock()
+		close(done)
+	}()
+
+	entry, err := c.download(ctx, u, checksum)
+	if err != nil {
+		return errors.Wrapf(err, "cannot fetch %s", u)
+	}
+	c.entriesMu.Lock()
+	defer c.entriesMu.Unlock()
+	c.entries[u] = entry
+	c.evict(u)
+	if err := c.saveIndex(); err != nil {
+		c.logger.Error().Err(err).Msg("cannot save cache index")
+	}
+	c.logger.Info().Msgf("cached %s (%d bytes)", u, entry.Size)
+	return nil
+}
+
+func (c *Cache) download(ctx context.Context, u string, checksum string) (*Entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create request")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load content")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	if c.maxSize > 0 && resp.ContentLength > c.maxSize {
+		return nil, errors.Errorf("content size %d exceeds cache size %d", resp.ContentLength, c.maxSize)
+	}
+	name := fileName(u)
+	tmp, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	var reader io.Reader = resp.Body
+	if c.maxSize > 0 {
+		reader = io.LimitReader(resp.Body, c.maxSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot write content")
+	}
+	if c.maxSize > 0 && size > c.maxSize {
+		return nil, errors.Errorf("content exceeds cache size %d", c.maxSize)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && sum != checksum {
+		return nil, errors.Errorf("checksum mismatch: %s expected, got %s", checksum, sum)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return nil, errors.Wrap(err, "cannot move content into cache")
+	}
+	now := time.Now()
+	return &Entry{
+		URL:         u,
+		File:        name,
+		Size:        size,
+		Checksum:    sum,
+		ContentType: resp.Header.Get("Content-Type"),
+		Fetched:     now,
+		LastUsed:    now,
+	}, nil
+}
+
+// evict removes the least recently used entries until the cache fits into maxSize.
+// keep is never removed. entriesMu must be held by the caller.
+func (c *Cache) evict(keep string) {
+	if c.maxSize <= 0 {
+		return
+	}
+	var size int64
+	var entries = []*Entry{}
+	for _, entry := range c.entries {
+		size += entry.Size
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int {
+		return a.LastUsed.Compare(b.LastUsed)
+	})
+	for _, entry := range entries {
+		if size <= c.maxSize {
+			return
+		}
+		if entry.URL == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.File)); err != nil && !os.IsNotExist(err) {
+			c.logger.Error().Err(err).Msgf("cannot remove cached file of %s", entry.URL)
+			continue
+		}
+		c.logger.Info().Msgf("evicted %s from cache", entry.URL)
+		delete(c.entries, entry.URL)
+		size -= entry.Size
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// NewServer creates a local http server for the cached content on addr (e.g. 127.0.0.1:0)
+func NewServer(c *Cache, addr string) *Server {
+	return &Server{
+		cache: c,
+		addr:  addr,
+	}
+}
+
+// Server delivers cached content to the browser of the display
+type Server struct {
+	cache    *Cache
+	addr     string
+	listener net.Listener
+	srv      *http.Server
+	wg       sync.WaitGroup
+}
+
+func (s *Server) Start() error {
+	var err error
+	if s.listener, err = net.Listen("tcp", s.addr); err != nil {
+		return errors.Wrapf(err, "cannot listen on %s", s.addr)
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/content/:name", s.content)
+	s.srv = &http.Server{Handler: router}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.srv.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+			s.cache.logger.Error().Err(err).Msg("cache server error")
+		}
+	}()
+	s.cache.logger.Info().Msgf("cache server listening on http://%s", s.listener.Addr().String())
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.srv == nil {
+		return errors.New("server not started")
+	}
+	err := s.srv.Close()
+	s.wg.Wait()
+	return errors.WithStack(err)
+}
+
+// Prefetch downloads u into the cache
+func (s *Server) Prefetch(ctx context.Context, u string, checksum string) error {
+	return s.cache.Prefetch(ctx, u, checksum)
+}
+
+// LocalURL returns the url of the cached content of u, if available
+func (s *Server) LocalURL(u string) (string, bool) {
+	entry, ok := s.cache.Get(u)
+	if !ok || s.listener == nil {
+		return "", false
+	}
+	return "http://" + s.listener.Addr().String() + "/content/" + entry.File, true
+}
+
+func (s *Server) content(c *gin.Context) {
+	name := c.Param("name")
+	var entry *Entry
+	for _, e := range s.cache.Entries() {
+		if e.File == name {
+			entry = e
+			break
+		}
+	}
+	if entry == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	fp, err := os.Open(filepath.Join(s.cache.dir, entry.File))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	defer fp.Close()
+	if entry.ContentType != "" {
+		c.Header("Content-Type", entry.ContentType)
+	}
+	// the player page is delivered by the proxy
+	c.Header("Access-Control-Allow-Origin", "*")
+	http.ServeContent(c.Writer, c.Request, "", entry.Fetched, fp)
+}
@@ -7,14 +7,14 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/beevik/ntp"
-	"github.com/gorilla/websocket"
 	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
 	"github.com/je4/utils/v2/pkg/zLogger"
 )
 
 type recFuncType func(evt *event.Event)
 
-func NewCommunication(proxy *websocket.Conn, name string, logger zLogger.ZLogger) *Communication {
+func NewCommunication(proxy transport.Transport, name string, logger zLogger.ZLogger) *Communication {
 	return &Communication{
 		proxyConn: proxy,
 		name:      name,
@@ -25,7 +25,7 @@ func NewCommunication(proxy *websocket.Conn, name string, logger zLogger.ZLogger
 }
 
 type Communication struct {
-	proxyConn   *websocket.Conn
+	proxyConn   transport.Transport
 	name        string
 	recFunc     recFuncType
 	logger      zLogger.ZLogger
@@ -46,11 +46,11 @@ func (comm *Communication) RemoveNTPReceiver() {
 }
 
 func (comm *Communication) Start() error {
+	comm.wg.Add(1)
 	go func() {
-		comm.wg.Add(1)
 		defer func() {
 			comm.logger.Info().Msgf("closing connection: %s", comm.name)
-			if err := comm.proxyConn.Close(); err != nil {
+			if err := comm.proxyConn.Close(); err != nil && !transport.IsClosed(err) {
 				comm.logger.Error().Err(err).Msgf("cannot close connection: %s", comm.name)
 			}
 			comm.wg.Done()
@@ -58,15 +58,10 @@ func (comm *Communication) Start() error {
 		for {
 			evt, err := comm.Receive()
 			if err != nil {
-				cause := errors.Cause(err)
-				if websocket.IsCloseError(cause, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure) {
+				if transport.IsClosed(err) {
 					comm.logger.Debug().Err(err).Msgf("connection closed: %s", comm.name)
 					return
 				}
-				if websocket.IsUnexpectedCloseError(cause, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure) {
-					comm.logger.Debug().Err(err).Msgf("unexpected close error: %s", comm.name)
-					return
-				}
 				comm.logger.Error().Err(err).Msgf("cannot read event: %s", comm.name)
 				continue
 			}
@@ -96,14 +91,8 @@ func (comm *Communication) Start() error {
 }
 
 func (comm *Communication) Stop() error {
-	deadline := time.Now().Add(10 * time.Second)
-	err := comm.proxyConn.WriteControl(
-		websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
-		deadline,
-	)
-	if err != nil {
-		return errors.Wrapf(err, "cannot send close message: %s", comm.name)
+	if err := comm.proxyConn.Close(); err != nil && !transport.IsClosed(err) {
+		comm.logger.Warn().Err(err).Msgf("cannot close connection: %s", comm.name)
 	}
 	closeChan := make(chan struct{})
 	go func() {
@@ -113,10 +102,7 @@ func (comm *Communication) Stop() error {
 	select {
 	case <-closeChan:
 	case <-time.After(time.Second * 10):
-		comm.logger.Warn().Msgf("timeout waiting for connection to close: %s", comm.name)
-		if err := comm.proxyConn.Close(); err != nil {
-			return errors.Wrapf(err, "cannot close connection: %s", comm.name)
-		}
+		return errors.Errorf("timeout waiting for connection to close: %s", comm.name)
 	}
 	return nil
 }
@@ -126,11 +112,11 @@ func (comm *Communication) On(recFunc recFuncType) {
 }
 
 func (comm *Communication) Receive() (*event.Event, error) {
-	var evt event.Event
-	if err := comm.proxyConn.ReadJSON(&evt); err != nil {
+	evt, err := comm.proxyConn.ReadEvent()
+	if err != nil {
 		return nil, errors.Wrapf(err, "cannot read event")
 	}
-	return &evt, nil
+	return evt, nil
 }
 
 func (comm *Communication) Send(evt *event.Event) error {
@@ -141,7 +127,7 @@ func (comm *Communication) Send(evt *event.Event) error {
 			return errors.Wrapf(err, "cannot create event: %v", data)
 		}
 	*/
-	if err := errors.Wrapf(comm.proxyConn.WriteJSON(evt), "cannot send event: %v", evt); err != nil {
+	if err := comm.proxyConn.WriteEvent(evt); err != nil {
 		return errors.Wrapf(err, "cannot send event: %v", evt)
 	}
 	return nil
@@ -173,3 +159,8 @@ func (comm *Communication) NTP() error {
 	comm.ClockOffset = response.ClockOffset
 	return nil
 }
+
+// Name returns the name of the client
+func (comm *Communication) Name() string {
+	return comm.name
+}
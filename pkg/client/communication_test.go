@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// ntpEpochOffset is the number of seconds between the ntp epoch (1900) and the unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// ntpResponse answers an ntp query with a stratum 1 server clock shifted by offset
+func ntpResponse(query []byte, offset time.Duration) []byte {
+	now := ntpTime(time.Now().Add(offset))
+	resp := make([]byte, 48)
+	resp[0] = 4<<3 | 4 // version 4, server mode
+	resp[1] = 1        // stratum
+	binary.BigEndian.PutUint64(resp[16:], now)
+	copy(resp[24:32], query[40:48])
+	binary.BigEndian.PutUint64(resp[32:], now)
+	binary.BigEndian.PutUint64(resp[40:], now)
+	return resp
+}
+
+// TestNTP queries the clock offset over the connection with a fake proxy on the other end of a pipe
+func TestNTP(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+
+	const offset = time.Hour
+	clientEnd, proxyEnd := transport.Pipe("display01", "proxy")
+	go func() {
+		for {
+			evt, err := proxyEnd.ReadEvent()
+			if err != nil {
+				return
+			}
+			if evt.GetType() != event.TypeNTPQuery || evt.GetSource() != "display01" {
+				continue
+			}
+			data, err := evt.GetData()
+			if err != nil {
+				t.Errorf("cannot get ntp query: %v", err)
+				return
+			}
+			jsonBytes, _ := json.Marshal(ntpResponse(data.([]byte), offset))
+			if err := proxyEnd.WriteEvent(&event.Event{
+				Type:   event.TypeNTPResponse,
+				Target: evt.GetSource(),
+				Data:   jsonBytes,
+			}); err != nil {
+				t.Errorf("cannot send ntp response: %v", err)
+				return
+			}
+		}
+	}()
+
+	comm := NewCommunication(clientEnd, "display01", logger)
+	if err := comm.Start(); err != nil {
+		t.Fatalf("cannot start communication: %v", err)
+	}
+	defer comm.Stop()
+	if err := comm.NTP(); err != nil {
+		t.Fatalf("ntp query failed: %v", err)
+	}
+	if diff := comm.ClockOffset - offset; diff < -time.Second || diff > time.Second {
+		t.Fatalf("expected clock offset %s, got %s", offset, comm.ClockOffset)
+	}
+}
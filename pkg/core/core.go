@@ -0,0 +1,365 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// DisplayState is the last known state of a client
+type DisplayState struct {
+	Name      string          `json:"name"`
+	Connected bool            `json:"connected"`
+	LastSeen  time.Time       `json:"lastSeen"`
+	Status    json.RawMessage `json:"status,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	// LastEvent is the type of the last non-status event from the client
+	LastEvent     string          `json:"lastEvent,omitempty"`
+	LastEventData json.RawMessage `json:"lastEventData,omitempty"`
+	// ScreenshotTime is the time of the last received screenshot
+	ScreenshotTime *time.Time `json:"screenshotTime,omitempty"`
+	// ConfigHash is the configuration hash of the last acknowledged config-update
+	ConfigHash string `json:"configHash,omitempty"`
+	// Health is the last health report of the display
+	Health *event.Health `json:"health,omitempty"`
+}
+
+func NewCore(comm *client.Communication, logger zLogger.ZLogger) *Core {
+	return &Core{
+		comm:        comm,
+		logger:      logger,
+		displays:    make(map[string]*DisplayState),
+		screenshots: make(map[string]*event.Screenshot),
+		logs:        make(map[string][]*event.LogEntry),
+		subscribers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Core aggregates the events sent to the core group and sends operator commands
+type Core struct {
+	comm        *client.Communication
+	logger      zLogger.ZLogger
+	displays    map[string]*DisplayState
+	screenshots map[string]*event.Screenshot
+	// logs are the entries of the last get-logs answer and the streamed entries of every display
+	logs        map[string][]*event.LogEntry
+	emergency   *event.Emergency
+	displaysMu  sync.RWMutex
+	subscribers map[chan struct{}]struct{}
+	subMu       sync.Mutex
+}
+
+func (c *Core) Start() {
+	c.comm.On(c.event)
+}
+
+func (c *Core) getState(name string) *DisplayState {
+	state, ok := c.displays[name]
+	if !ok {
+		state = &DisplayState{Name: name}
+		c.displays[name] = state
+	}
+	return state
+}
+
+// Subscribe returns a channel, which receives a notification on every state change.
+// The returned function must be called to unsubscribe.
+func (c *Core) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	c.subMu.Lock()
+	c.subscribers[ch] = struct{}{}
+	c.subMu.Unlock()
+	return ch, func() {
+		c.subMu.Lock()
+		delete(c.subscribers, ch)
+		c.subMu.Unlock()
+	}
+}
+
+func (c *Core) notify() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for ch := range c.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// notification pending
+		}
+	}
+}
+
+func (c *Core) event(evt *event.Event) {
+	c.displaysMu.Lock()
+	defer c.displaysMu.Unlock()
+	defer c.notify()
+	switch evt.GetType() {
+	case event.TypeConnected, event.TypeDisconnected:
+		data, err := evt.GetData()
+		if err != nil {
+			c.logger.Error().Err(err).Msgf("cannot get data of %s event", evt.GetType())
+			return
+		}
+		name, _ := data.(string)
+		if name == "" || name == c.comm.Name() {
+			return
+		}
+		state := c.getState(name)
+		state.Connected = evt.GetType() == event.TypeConnected
+		state.LastSeen = time.Now()
+	case event.TypeStatus:
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		state.Status = evt.Data
+	case event.TypeScreenshot:
+		var screenshot = &event.Screenshot{}
+		if err := json.Unmarshal(evt.Data, screenshot); err != nil || len(screenshot.Image) == 0 {
+			// screenshot request of another client
+			return
+		}
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		now := time.Now()
+		state.Connected = true
+		state.LastSeen = now
+		state.ScreenshotTime = &now
+		c.screenshots[evt.GetSource()] = screenshot
+	case event.TypeEmergency:
+		// sent by the proxy on connect or by another core
+		var emergency = &event.Emergency{}
+		if err := evt.GetPageData(emergency); err != nil {
+			c.logger.Error().Err(err).Msg("invalid emergency event")
+			return
+		}
+		c.emergency = emergency
+	case event.TypeEmergencyClear:
+		c.emergency = nil
+	case event.TypeConfigApplied:
+		var applied = &event.ConfigApplied{}
+		if err := json.Unmarshal(evt.Data, applied); err != nil {
+			c.logger.Error().Err(err).Msg("invalid config-applied event")
+			return
+		}
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		state.ConfigHash = applied.Hash
+	case event.TypeLogs:
+		var logs = &event.Logs{}
+		if err := json.Unmarshal(evt.Data, logs); err != nil {
+			c.logger.Error().Err(err).Msg("invalid logs event")
+			return
+		}
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		c.logs[evt.GetSource()] = logs.Entries
+	case event.TypeLog:
+		var entry = &event.LogEntry{}
+		if err := json.Unmarshal(evt.Data, entry); err != nil {
+			c.logger.Error().Err(err).Msg("invalid log event")
+			return
+		}
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		logs := append(c.logs[evt.GetSource()], entry)
+		if len(logs) > maxLogEntries {
+			logs = logs[len(logs)-maxLogEntries:]
+		}
+		c.logs[evt.GetSource()] = logs
+	case event.TypeHealth:
+		var health = &event.Health{}
+		if err := json.Unmarshal(evt.Data, health); err != nil {
+			c.logger.Error().Err(err).Msg("invalid health event")
+			return
+		}
+		if evt.GetSource() == "" {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		state.Health = health
+	default:
+		// events of other clients like load commands are ignored
+		if evt.GetSource() == "" || slices.Contains(commandTypes, evt.GetType()) {
+			return
+		}
+		state := c.getState(evt.GetSource())
+		state.Connected = true
+		state.LastSeen = time.Now()
+		state.LastEvent = string(evt.GetType())
+		state.LastEventData = evt.Data
+	}
+}
+
+// commandTypes are the events an operator can send to a display
+var commandTypes = []event.EventType{
+	event.TypeLoad,
+	event.TypePlay,
+	event.TypePause,
+	event.TypeStop,
+	event.TypeUnload,
+	event.TypeReload,
+	event.TypeSetVolume,
+	event.TypePrefetch,
+	event.TypeBrowserNavigate,
+	event.TypeBrowserPreload,
+	event.TypeOverlay,
+	event.TypeEmergency,
+	event.TypeEmergencyClear,
+	event.TypeConfigUpdate,
+	event.TypeGetLogs,
+	event.TypeLogStream,
+	event.TypeRestartBrowser,
+	event.TypeRestartDisplay,
+	event.TypeScreenPower,
+	event.TypeMute,
+	event.TypeUnmute,
+	event.TypeFadeIn,
+	event.TypeFadeOut,
+}
+
+// maxLogEntries limits the stored log entries per display
+const maxLogEntries = 5000
+
+// Displays returns a copy of all known states sorted by name
+func (c *Core) Displays() []*DisplayState {
+	c.displaysMu.RLock()
+	defer c.displaysMu.RUnlock()
+	var result = []*DisplayState{}
+	for _, state := range c.displays {
+		s := *state
+		result = append(result, &s)
+	}
+	slices.SortFunc(result, func(a, b *DisplayState) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
+
+func (c *Core) Display(name string) (*DisplayState, bool) {
+	c.displaysMu.RLock()
+	defer c.displaysMu.RUnlock()
+	state, ok := c.displays[name]
+	if !ok {
+		return nil, false
+	}
+	s := *state
+	return &s, true
+}
+
+// Screenshot returns the last screenshot of a display
+func (c *Core) Screenshot(name string) (*event.Screenshot, bool) {
+	c.displaysMu.RLock()
+	defer c.displaysMu.RUnlock()
+	screenshot, ok := c.screenshots[name]
+	return screenshot, ok
+}
+
+// Logs returns the received log entries of a display
+func (c *Core) Logs(name string) ([]*event.LogEntry, bool) {
+	c.displaysMu.RLock()
+	defer c.displaysMu.RUnlock()
+	logs, ok := c.logs[name]
+	return slices.Clone(logs), ok
+}
+
+// Command sends the command of operator to a display or group. token is the signed content manifest for load events.
+func (c *Core) Command(operator string, target string, t event.EventType, data interface{}, token string) error {
+	if target == "" {
+		return errors.New("no target")
+	}
+	evt, err := event.NewPageEvent(t, target, data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create %s event", t)
+	}
+	evt.Token = token
+	evt.Operator = operator
+	c.logger.Info().Msgf("operator %s sends %s to %s", operator, t, target)
+	if err := c.comm.Send(evt); err != nil {
+		return errors.Wrapf(err, "cannot send %s to %s", t, target)
+	}
+	if t == event.TypeLoad {
+		if u, ok := data.(string); ok {
+			c.displaysMu.Lock()
+			if state, ok := c.displays[target]; ok {
+				state.URL = u
+			}
+			c.displaysMu.Unlock()
+			c.notify()
+		}
+	}
+	return nil
+}
+
+// Emergency shows a notice of operator on all displays until it is cleared. The proxy sends it to every connection.
+func (c *Core) Emergency(operator string, title string, message string) (*event.Emergency, error) {
+	emergency := &event.Emergency{
+		ID:      fmt.Sprintf("%d", time.Now().UnixNano()),
+		Title:   title,
+		Message: message,
+	}
+	evt, err := event.NewPageEvent(event.TypeEmergency, "*", emergency)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create emergency event")
+	}
+	evt.Operator = operator
+	c.logger.Warn().Msgf("operator %s sends emergency %s", operator, emergency.ID)
+	if err := c.comm.Send(evt); err != nil {
+		return nil, errors.Wrap(err, "cannot send emergency")
+	}
+	c.displaysMu.Lock()
+	c.emergency = emergency
+	c.displaysMu.Unlock()
+	c.notify()
+	return emergency, nil
+}
+
+// ClearEmergency ends the emergency with the id for operator, an empty id ends the active emergency
+func (c *Core) ClearEmergency(operator string, id string) error {
+	evt, err := event.NewPageEvent(event.TypeEmergencyClear, "*", id)
+	if err != nil {
+		return errors.Wrap(err, "cannot create emergency-clear event")
+	}
+	evt.Operator = operator
+	c.logger.Warn().Msgf("operator %s clears emergency %s", operator, id)
+	if err := c.comm.Send(evt); err != nil {
+		return errors.Wrap(err, "cannot send emergency-clear")
+	}
+	c.displaysMu.Lock()
+	c.emergency = nil
+	c.displaysMu.Unlock()
+	c.notify()
+	return nil
+}
+
+// ActiveEmergency returns the active emergency or nil
+func (c *Core) ActiveEmergency() *event.Emergency {
+	c.displaysMu.RLock()
+	defer c.displaysMu.RUnlock()
+	return c.emergency
+}
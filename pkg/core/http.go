@@ -0,0 +1,285 @@
+package core
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+func NewServer(addr string, c *Core, staticFS fs.FS, templateFS fs.FS, logger zLogger.ZLogger) *Server {
+	return &Server{
+		addr:       addr,
+		core:       c,
+		staticFS:   staticFS,
+		templateFS: templateFS,
+		logger:     logger,
+	}
+}
+
+// Server provides the dashboard and the http api of core
+type Server struct {
+	addr       string
+	core       *Core
+	staticFS   fs.FS
+	templateFS fs.FS
+	logger     zLogger.ZLogger
+	srv        *http.Server
+	wg         sync.WaitGroup
+	operators  []*Operator
+	commands   []event.EventType
+}
+
+// Operator is a person allowed to send commands and emergencies
+type Operator struct {
+	Name string `toml:"name"`
+	// Token authenticates the operator with the header "Authorization: Bearer <token>", empty disables
+	Token string `toml:"token"`
+	// Certs are the dns names of client certificates of the operator
+	Certs []string `toml:"certs"`
+}
+
+// SetOperators sets the operators of the command and emergency api, without operators all requests are rejected.
+// It must be called before Start.
+func (srv *Server) SetOperators(operators []*Operator) {
+	srv.operators = operators
+}
+
+// SetCommands sets the event types operators may send to displays and groups.
+// It must be called before Start.
+func (srv *Server) SetCommands(commands []event.EventType) {
+	srv.commands = commands
+}
+
+// Command is an operator command for a display or group
+type Command struct {
+	Type event.EventType `json:"type"`
+	Data interface{}     `json:"data"`
+	// Token is the signed content manifest of a load or browser-navigate command
+	Token string `json:"token,omitempty"`
+}
+
+// handler returns the routes of the dashboard and the api
+func (srv *Server) handler() http.Handler {
+	router := gin.Default()
+	router.StaticFS("/static", http.FS(srv.staticFS))
+	router.GET("/", srv.dashboard)
+	api := router.Group("/api")
+	api.GET("/displays", func(c *gin.Context) {
+		c.JSON(http.StatusOK, srv.core.Displays())
+	})
+	api.GET("/displays/:name", func(c *gin.Context) {
+		state, ok := srv.core.Display(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown display " + c.Param("name")})
+			return
+		}
+		c.JSON(http.StatusOK, state)
+	})
+	api.GET("/displays/:name/screenshot", srv.screenshot)
+	api.GET("/displays/:name/logs", srv.logs)
+	api.GET("/stream", srv.stream)
+	api.POST("/displays/:name/command", srv.operatorOnly, srv.command)
+	api.POST("/groups/:name/command", srv.operatorOnly, srv.command)
+	api.GET("/emergency", func(c *gin.Context) {
+		c.JSON(http.StatusOK, srv.core.ActiveEmergency())
+	})
+	api.POST("/emergency", srv.operatorOnly, srv.emergency)
+	api.DELETE("/emergency", srv.operatorOnly, srv.clearEmergency)
+	return router
+}
+
+func (srv *Server) Start(tlsConfig *tls.Config) error {
+	srv.srv = &http.Server{
+		Addr:      srv.addr,
+		Handler:   srv.handler(),
+		TLSConfig: tlsConfig,
+	}
+	srv.wg.Add(1)
+	go func() {
+		defer srv.wg.Done()
+		var err error
+		if tlsConfig == nil {
+			srv.logger.Info().Msgf("Starting core server on http://%s", srv.addr)
+			err = srv.srv.ListenAndServe()
+		} else {
+			srv.logger.Info().Msgf("Starting core server on https://%s", srv.addr)
+			err = srv.srv.ListenAndServeTLS("", "")
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			srv.logger.Error().Err(err).Msg("Server error")
+		} else {
+			srv.logger.Info().Msg("Server closed")
+		}
+	}()
+	return nil
+}
+
+func (srv *Server) Stop() error {
+	if srv.srv == nil {
+		return errors.New("server not started")
+	}
+	if err := srv.srv.Close(); err != nil {
+		return errors.Wrap(err, "cannot close server")
+	}
+	srv.wg.Wait()
+	return nil
+}
+
+func (srv *Server) dashboard(c *gin.Context) {
+	tmpl, err := template.New("core.gohtml").ParseFS(srv.templateFS, "core.gohtml")
+	if err != nil {
+		srv.logger.Error().Err(err).Msg("Failed to get template core.gohtml")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(c.Writer, struct{ Displays []*DisplayState }{Displays: srv.core.Displays()}); err != nil {
+		srv.logger.Error().Err(err).Msg("Failed to execute template")
+	}
+}
+
+func (srv *Server) screenshot(c *gin.Context) {
+	screenshot, ok := srv.core.Screenshot(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no screenshot of " + c.Param("name")})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, screenshot.MimeType, screenshot.Image)
+}
+
+// logs returns the log entries received from a display
+func (srv *Server) logs(c *gin.Context) {
+	logs, ok := srv.core.Logs(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no logs of " + c.Param("name")})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
+
+// stream sends the state of all displays as server-sent events on every change
+func (srv *Server) stream(c *gin.Context) {
+	ch, unsubscribe := srv.core.Subscribe()
+	defer unsubscribe()
+	c.SSEvent("displays", srv.core.Displays())
+	c.SSEvent("emergency", srv.core.ActiveEmergency())
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ch:
+			c.SSEvent("displays", srv.core.Displays())
+			c.SSEvent("emergency", srv.core.ActiveEmergency())
+			return true
+		case <-time.After(30 * time.Second):
+			// keep proxies from closing the idle connection
+			c.SSEvent("ping", "")
+			return true
+		}
+	})
+}
+
+// operator returns the operator authenticated by the bearer token or the client certificate of the request
+func (srv *Server) operator(r *http.Request) (*Operator, bool) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+		for _, op := range srv.operators {
+			if op.Token != "" && subtle.ConstantTimeCompare([]byte(op.Token), []byte(token)) == 1 {
+				return op, true
+			}
+		}
+		return nil, false
+	}
+	// the certificates are verified by the tls config of the server
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, false
+	}
+	names := r.TLS.VerifiedChains[0][0].DNSNames
+	for _, op := range srv.operators {
+		if slices.ContainsFunc(op.Certs, func(cert string) bool { return slices.Contains(names, cert) }) {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+// operatorOnly aborts requests, which are not authenticated as an operator
+func (srv *Server) operatorOnly(c *gin.Context) {
+	if len(srv.operators) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no operators configured"})
+		return
+	}
+	op, ok := srv.operator(c.Request)
+	if !ok {
+		srv.logger.Warn().Msgf("unauthenticated %s %s from %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "operator token or certificate required"})
+		return
+	}
+	c.Set("operator", op.Name)
+	c.Next()
+}
+
+func (srv *Server) command(c *gin.Context) {
+	var cmd = &Command{}
+	if err := c.ShouldBindJSON(cmd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if cmd.Type == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no command type"})
+		return
+	}
+	if !slices.Contains(srv.commands, cmd.Type) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "command type " + string(cmd.Type) + " not allowed"})
+		return
+	}
+	target := c.Param("name")
+	if err := srv.core.Command(c.GetString("operator"), target, cmd.Type, cmd.Data, cmd.Token); err != nil {
+		srv.logger.Error().Err(err).Msgf("cannot send command %s to %s", cmd.Type, target)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"target": target, "type": cmd.Type})
+}
+
+// emergency sends an emergency notice with title and message to all displays
+func (srv *Server) emergency(c *gin.Context) {
+	var req = &event.Emergency{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no message"})
+		return
+	}
+	emergency, err := srv.core.Emergency(c.GetString("operator"), req.Title, req.Message)
+	if err != nil {
+		srv.logger.Error().Err(err).Msg("cannot send emergency")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, emergency)
+}
+
+// clearEmergency ends the emergency given by the query parameter id or the active one
+func (srv *Server) clearEmergency(c *gin.Context) {
+	if err := srv.core.ClearEmergency(c.GetString("operator"), c.Query("id")); err != nil {
+		srv.logger.Error().Err(err).Msg("cannot clear emergency")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cleared": true})
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+func TestCommandAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+
+	coreEnd, proxyEnd := transport.Pipe("core01", "proxy")
+	defer proxyEnd.Close()
+	srv := NewServer("", NewCore(client.NewCommunication(coreEnd, "core01", logger), logger), nil, nil, logger)
+	srv.SetCommands([]event.EventType{event.TypePlay})
+	handler := srv.handler()
+
+	request := func(token string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/displays/display01/command", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("secret", `{"type":"play"}`); code != http.StatusForbidden {
+		t.Fatalf("without operators: expected %d, got %d", http.StatusForbidden, code)
+	}
+	srv.SetOperators([]*Operator{{Name: "operator01", Token: "secret"}, {Name: "certonly", Certs: []string{"certonly"}}})
+	for _, test := range []struct {
+		name  string
+		token string
+		body  string
+		code  int
+	}{
+		{name: "no token", body: `{"type":"play"}`, code: http.StatusUnauthorized},
+		{name: "wrong token", token: "wrong", body: `{"type":"play"}`, code: http.StatusUnauthorized},
+		{name: "type not allowed", token: "secret", body: `{"type":"restart-display"}`, code: http.StatusForbidden},
+		{name: "allowed", token: "secret", body: `{"type":"play"}`, code: http.StatusOK},
+	} {
+		if code := request(test.token, test.body); code != test.code {
+			t.Fatalf("%s: expected %d, got %d", test.name, test.code, code)
+		}
+	}
+
+	received := make(chan *event.Event, 1)
+	go func() {
+		if evt, err := proxyEnd.ReadEvent(); err == nil {
+			received <- evt
+		}
+	}()
+	select {
+	case evt := <-received:
+		if evt.GetType() != event.TypePlay || evt.GetTarget() != "display01" || evt.Operator != "operator01" {
+			t.Fatalf("unexpected event %s from operator %s", evt, evt.Operator)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not sent")
+	}
+}
@@ -0,0 +1,35 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// GenerateWAV creates a mono 16bit pcm wave file with a sine tone
+func GenerateWAV(duration time.Duration, freq float64) []byte {
+	const sampleRate = 8000
+	numSamples := int(duration.Seconds() * sampleRate)
+	dataSize := numSamples * 2
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(16))           // chunk size
+	binary.Write(buf, binary.LittleEndian, uint16(1))            // pcm
+	binary.Write(buf, binary.LittleEndian, uint16(1))            // channels
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(buf, binary.LittleEndian, uint16(16))           // bits per sample
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(dataSize))
+	for i := 0; i < numSamples; i++ {
+		sample := int16(math.Sin(2*math.Pi*freq*float64(i)/sampleRate) * math.MaxInt16 / 4)
+		binary.Write(buf, binary.LittleEndian, sample)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,105 @@
+package e2e
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// Certs contains a self-signed CA with a server certificate for localhost
+// and a client certificate with a ws:<name> dns name for every client
+type Certs struct {
+	CA        *x509.CertPool
+	ServerTLS *tls.Config
+	ClientTLS *tls.Config
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func createCert(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate key")
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate serial")
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot create certificate %s", template.Subject.CommonName)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot parse certificate %s", template.Subject.CommonName)
+	}
+	return cert, key, nil
+}
+
+// GenerateCerts creates the certificates for a test setup on localhost
+func GenerateCerts(clientNames []string) (*Certs, error) {
+	caCert, caKey, err := createCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "securedisplay test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create ca")
+	}
+	serverCert, serverKey, err := createCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create server certificate")
+	}
+	var dnsNames = []string{}
+	for _, name := range clientNames {
+		dnsNames = append(dnsNames, "ws:"+name)
+	}
+	clientCert, clientKey, err := createCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "securedisplay test client"},
+		DNSNames:    dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create client certificate")
+	}
+	ca := x509.NewCertPool()
+	ca.AddCert(caCert)
+	return &Certs{
+		CA: ca,
+		ServerTLS: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey, Leaf: serverCert}},
+			ClientCAs:    ca,
+			// the browser loads the player page without client certificate
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		},
+		ClientTLS: &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey, Leaf: clientCert}},
+			RootCAs:      ca,
+		},
+	}, nil
+}
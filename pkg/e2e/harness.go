@@ -0,0 +1,251 @@
+package e2e
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/data"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/genericplayer"
+	"github.com/je4/securedisplay/pkg/proxy"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// ObserverName is the name of the client, which receives all events sent to core
+const ObserverName = "observer"
+
+// NewHarness creates a test environment with a proxy on localhost and a media server for the
+// files in mediaDir. The displays are connected with ClientTLS.
+func NewHarness(displayNames []string, mediaDir string, logger zLogger.ZLogger) (*Harness, error) {
+	certs, err := GenerateCerts(append([]string{ObserverName}, displayNames...))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate certificates")
+	}
+	return &Harness{
+		certs:      certs,
+		mediaDir:   mediaDir,
+		logger:     logger,
+		statusChan: make(chan *event.Event, 100),
+		comms:      []*client.Communication{},
+	}, nil
+}
+
+type Harness struct {
+	certs      *Certs
+	mediaDir   string
+	logger     zLogger.ZLogger
+	proxy      *proxy.SocketServer
+	proxyAddr  string
+	mediaSrv   *http.Server
+	mediaAddr  string
+	observer   *client.Communication
+	statusChan chan *event.Event
+	comms      []*client.Communication
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot find free port")
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// Start starts the proxy, the media server and the observer client
+func (h *Harness) Start() error {
+	var err error
+	if h.proxyAddr, err = freeAddr(); err != nil {
+		return err
+	}
+	staticFS, err := fs.Sub(data.FS, "static")
+	if err != nil {
+		return errors.Wrap(err, "cannot create static file system")
+	}
+	templateFS, err := fs.Sub(data.FS, "templates")
+	if err != nil {
+		return errors.Wrap(err, "cannot create template file system")
+	}
+	h.proxy, err = proxy.NewSocketServer(h.proxyAddr, h.proxyAddr, 2, "localhost", staticFS, templateFS, false, h.logger)
+	if err != nil {
+		return errors.Wrap(err, "cannot create proxy")
+	}
+	if err := h.proxy.Start(h.certs.ServerTLS); err != nil {
+		return errors.Wrap(err, "cannot start proxy")
+	}
+
+	if err := h.startMediaServer(); err != nil {
+		return err
+	}
+
+	if err := h.waitForProxy(10 * time.Second); err != nil {
+		return err
+	}
+	h.observer, err = h.Connect(ObserverName, func(evt *event.Event) {
+		if evt.GetType() != event.TypeStatus {
+			return
+		}
+		select {
+		case h.statusChan <- evt:
+		default:
+			h.logger.Warn().Msgf("status channel full, dropping status from %s", evt.GetSource())
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "cannot connect observer")
+	}
+	return nil
+}
+
+func (h *Harness) waitForProxy(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		conn, err := tls.Dial("tcp", h.proxyAddr, h.certs.ClientTLS)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return errors.Errorf("proxy not reachable at %s", h.proxyAddr)
+}
+
+func (h *Harness) startMediaServer() error {
+	var err error
+	if h.mediaAddr, err = freeAddr(); err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", h.mediaAddr, &tls.Config{Certificates: h.certs.ServerTLS.Certificates})
+	if err != nil {
+		return errors.Wrapf(err, "cannot listen on %s", h.mediaAddr)
+	}
+	h.mediaSrv = &http.Server{Handler: http.FileServer(http.Dir(h.mediaDir))}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		if err := h.mediaSrv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			h.logger.Error().Err(err).Msg("media server error")
+		}
+	}()
+	return nil
+}
+
+// MediaURL returns the url of a file in the media folder
+func (h *Harness) MediaURL(name string) string {
+	return fmt.Sprintf("https://%s/%s", h.mediaAddr, name)
+}
+
+// ProxyURL returns the websocket url of the proxy
+func (h *Harness) ProxyURL() string {
+	return fmt.Sprintf("wss://%s/ws", h.proxyAddr)
+}
+
+// ClientTLS returns the client identity of the displays
+func (h *Harness) ClientTLS() *tls.Config {
+	return h.certs.ClientTLS
+}
+
+// PlayerURL returns the url of the roundaudio player page, the display name is appended by the display
+func (h *Harness) PlayerURL() string {
+	return fmt.Sprintf("https://%s/roundaudio", h.proxyAddr)
+}
+
+// Connect creates a client connection to the proxy and attaches it to the core group
+func (h *Harness) Connect(name string, recFunc func(evt *event.Event)) (*client.Communication, error) {
+	wsDialer := &websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  h.certs.ClientTLS,
+	}
+	wsPath := fmt.Sprintf("wss://%s/ws/%s", h.proxyAddr, name)
+	c, _, err := wsDialer.Dial(wsPath, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to %s", wsPath)
+	}
+	comm := client.NewCommunication(transport.NewWebsocket(c), name, h.logger)
+	if recFunc != nil {
+		comm.On(recFunc)
+	}
+	if err := comm.Start(); err != nil {
+		return nil, errors.Wrapf(err, "cannot start communication for %s", name)
+	}
+	h.comms = append(h.comms, comm)
+	jsonBytes, err := json.Marshal("core")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal group")
+	}
+	if err := comm.Send(&event.Event{
+		Type:   event.TypeAttach,
+		Source: name,
+		Target: "",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot attach %s to core", name)
+	}
+	return comm, nil
+}
+
+// Send sends an event from the observer. The data is encoded as expected by the player pages.
+func (h *Harness) Send(evtType event.EventType, target string, data interface{}) error {
+	evt, err := event.NewPageEvent(evtType, target, data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create %s event", evtType)
+	}
+	return h.observer.Send(evt)
+}
+
+// WaitStatus waits for a status event of source, which fulfills check
+func (h *Harness) WaitStatus(ctx context.Context, source string, check func(status *genericplayer.PlayerStatus) bool) (*genericplayer.PlayerStatus, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "no matching status from %s", source)
+		case evt := <-h.statusChan:
+			if evt.GetSource() != source {
+				continue
+			}
+			var status = &genericplayer.PlayerStatus{}
+			if err := json.Unmarshal(evt.Data, status); err != nil {
+				return nil, errors.Wrapf(err, "cannot unmarshal status from %s: %s", source, string(evt.Data))
+			}
+			h.logger.Debug().Interface("status", status).Msgf("status from %s", source)
+			if check(status) {
+				return status, nil
+			}
+		}
+	}
+}
+
+func (h *Harness) Close() {
+	h.closeOnce.Do(func() {
+		for _, comm := range h.comms {
+			if err := comm.Stop(); err != nil {
+				h.logger.Error().Err(err).Msg("cannot stop communication")
+			}
+		}
+		if h.mediaSrv != nil {
+			if err := h.mediaSrv.Close(); err != nil {
+				h.logger.Error().Err(err).Msg("cannot close media server")
+			}
+		}
+		if h.proxy != nil {
+			if err := h.proxy.Stop(); err != nil {
+				h.logger.Error().Err(err).Msg("cannot stop proxy")
+			}
+		}
+		h.wg.Wait()
+	})
+}
@@ -0,0 +1,24 @@
+package event
+
+import "emperror.dev/errors"
+
+// Fade is the data of fade-in and fade-out events
+type Fade struct {
+	// Duration of the fade in seconds
+	Duration float64 `json:"duration"`
+	// Volume is the target of fade-in (0.0 to 1.0), 0 uses the default volume of the page
+	Volume float64 `json:"volume,omitempty"`
+	// Pause stops the playback after fade-out and restores the volume
+	Pause bool `json:"pause,omitempty"`
+}
+
+// Check validates the fade parameters
+func (f *Fade) Check() error {
+	if f.Duration < 0 {
+		return errors.Errorf("invalid fade duration %v", f.Duration)
+	}
+	if f.Volume < 0 || f.Volume > 1 {
+		return errors.Errorf("invalid fade volume %v", f.Volume)
+	}
+	return nil
+}
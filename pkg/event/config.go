@@ -0,0 +1,45 @@
+package event
+
+// Settings are the display settings, which can be changed with a config-update event. Nil fields keep their value.
+type Settings struct {
+	// PlayerURL must be in the allowed origins of the display
+	PlayerURL *string `json:"playerURL,omitempty"`
+	// Volume is the default volume (0.0 to 1.0) of the player page
+	Volume *float64 `json:"volume,omitempty"`
+	// AllowedOrigins, RequireSignature and TrustedKeys are the content policy. Pushing it is out of scope:
+	// a sender could widen the allowlist it is checked against, so displays refuse it until pushes
+	// signed by a trusted key are implemented. It is part of the local configuration only.
+	AllowedOrigins   *[]string `json:"allowedOrigins,omitempty"`
+	RequireSignature *bool     `json:"requireSignature,omitempty"`
+	TrustedKeys      *[]string `json:"trustedKeys,omitempty"`
+	// Groups are joined by the display, i.e. the schedules of these groups are played
+	Groups *[]string `json:"groups,omitempty"`
+}
+
+// Merge copies the fields set in update except the content policy
+func (s *Settings) Merge(update *Settings) {
+	if update.PlayerURL != nil {
+		s.PlayerURL = update.PlayerURL
+	}
+	if update.Volume != nil {
+		s.Volume = update.Volume
+	}
+	if update.Groups != nil {
+		s.Groups = update.Groups
+	}
+}
+
+// ConfigApplied acknowledges a config-update with the hash of the resulting configuration
+type ConfigApplied struct {
+	Hash string `json:"hash"`
+}
+
+func (c *ConfigApplied) String() string {
+	return "config " + c.Hash
+}
+
+func (c *ConfigApplied) Type() EventType {
+	return TypeConfigApplied
+}
+
+var _ DataInterface = (*ConfigApplied)(nil)
@@ -0,0 +1,8 @@
+package event
+
+// Emergency is a notice shown full-screen on all displays until an emergency-clear event with its ID arrives
+type Emergency struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
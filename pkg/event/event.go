@@ -31,6 +31,8 @@ type Event struct {
 	Target string          `json:"target"`
 	Token  string          `json:"token"`
 	Data   json.RawMessage `json:"data"`
+	// Operator is the authenticated person, who issued the event at the core
+	Operator string `json:"operator,omitempty"`
 }
 
 func (e *Event) String() string {
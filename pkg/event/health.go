@@ -0,0 +1,49 @@
+package event
+
+import (
+	"fmt"
+	"time"
+)
+
+// NetInterface is a network interface of a display
+type NetInterface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Up    bool     `json:"up"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+// Health is the system state of a display, which is sent periodically to core. Values, which
+// cannot be determined on the system, are zero.
+type Health struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	// Load1, Load5 and Load15 are the load averages
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+	// MemTotal and MemAvailable are in bytes
+	MemTotal     uint64 `json:"memTotal"`
+	MemAvailable uint64 `json:"memAvailable"`
+	// DiskTotal and DiskFree are in bytes
+	DiskTotal uint64 `json:"diskTotal"`
+	DiskFree  uint64 `json:"diskFree"`
+	// CPUTemperature is the highest temperature of the thermal zones in °C
+	CPUTemperature float64 `json:"cpuTemperature"`
+	// Uptime of the display process and SystemUptime in seconds
+	Uptime       float64 `json:"uptime"`
+	SystemUptime float64 `json:"systemUptime"`
+	// Browser are the chrome performance metrics of the visible page like JSHeapUsedSize
+	Browser    map[string]float64 `json:"browser,omitempty"`
+	Interfaces []*NetInterface    `json:"interfaces,omitempty"`
+}
+
+func (h *Health) String() string {
+	return fmt.Sprintf("health of %s: load %.2f, %.1f°C", h.Hostname, h.Load1, h.CPUTemperature)
+}
+
+func (h *Health) Type() EventType {
+	return TypeHealth
+}
+
+var _ DataInterface = (*Health)(nil)
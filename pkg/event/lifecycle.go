@@ -0,0 +1,32 @@
+package event
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScreenPower is the data of a screen-power event
+type ScreenPower struct {
+	On bool `json:"on"`
+}
+
+// CommandResult reports the outcome of a restart-browser, restart-display or screen-power event
+type CommandResult struct {
+	Command EventType `json:"command"`
+	Success bool      `json:"success"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+func (r *CommandResult) String() string {
+	if r.Success {
+		return fmt.Sprintf("%s: %s", r.Command, r.Message)
+	}
+	return fmt.Sprintf("%s failed: %s", r.Command, r.Message)
+}
+
+func (r *CommandResult) Type() EventType {
+	return TypeCommandResult
+}
+
+var _ DataInterface = (*CommandResult)(nil)
@@ -0,0 +1,63 @@
+package event
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	LogSourceGo      = "go"
+	LogSourceBrowser = "browser"
+)
+
+// LogEntry is a message of the display log or the browser console
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	// Source is go or browser
+	Source string `json:"source"`
+	// Level is a zerolog level name like debug or error
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func (l *LogEntry) String() string {
+	return fmt.Sprintf("%s %s [%s] %s", l.Time.Format(time.RFC3339), l.Source, l.Level, l.Message)
+}
+
+// Type of a live log entry of a log-stream
+func (l *LogEntry) Type() EventType {
+	return TypeLog
+}
+
+var _ DataInterface = (*LogEntry)(nil)
+
+// LogQuery is the data of a get-logs event. Empty values select all entries.
+type LogQuery struct {
+	// Level is the minimum level
+	Level  string `json:"level,omitempty"`
+	Source string `json:"source,omitempty"`
+	// Limit returns the newest entries only
+	Limit int `json:"limit,omitempty"`
+}
+
+// Logs is the answer to a get-logs event, the entries are sorted by time
+type Logs struct {
+	Entries []*LogEntry `json:"entries"`
+}
+
+func (l *Logs) String() string {
+	return fmt.Sprintf("%d log entries", len(l.Entries))
+}
+
+func (l *Logs) Type() EventType {
+	return TypeLogs
+}
+
+var _ DataInterface = (*Logs)(nil)
+
+// LogStream is the data of a log-stream event. While enabled, browser console entries with
+// the minimum level are sent to the source of the event. The default level is error.
+type LogStream struct {
+	Enabled bool   `json:"enabled"`
+	Level   string `json:"level,omitempty"`
+}
@@ -0,0 +1,37 @@
+package event
+
+import (
+	"encoding/json"
+
+	"emperror.dev/errors"
+)
+
+// NewPageEvent creates an event for the player pages.
+// The pages parse the data field as json string, so data is encoded twice.
+func NewPageEvent(t EventType, target string, data interface{}) (*Event, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal data for %s", t)
+	}
+	jsonBytes, err := json.Marshal(string(dataBytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot marshal data for %s", t)
+	}
+	return &Event{
+		Type:   t,
+		Target: target,
+		Data:   jsonBytes,
+	}, nil
+}
+
+// GetPageData decodes the data of an event created by NewPageEvent
+func (e *Event) GetPageData(v interface{}) error {
+	var str string
+	if err := json.Unmarshal(e.Data, &str); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal page data of %s event: %s", e.Type, string(e.Data))
+	}
+	if err := json.Unmarshal([]byte(str), v); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal page data of %s event: %s", e.Type, str)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package event
+
+// Prefetch announces content, which should be stored in the cache of a display
+type Prefetch struct {
+	URL string `json:"url"`
+	// Checksum is the optional sha256 (hex) of the content
+	Checksum string `json:"checksum,omitempty"`
+}
@@ -0,0 +1,19 @@
+package event
+
+import "fmt"
+
+// Screenshot is the answer of a display to a screenshot request
+type Screenshot struct {
+	MimeType string `json:"mimeType"`
+	Image    []byte `json:"image"`
+}
+
+func (s *Screenshot) String() string {
+	return fmt.Sprintf("%s screenshot (%d bytes)", s.MimeType, len(s.Image))
+}
+
+func (s *Screenshot) Type() EventType {
+	return TypeScreenshot
+}
+
+var _ DataInterface = (*Screenshot)(nil)
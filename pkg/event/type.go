@@ -9,3 +9,38 @@ const TypeNTPQuery EventType = "ntp-query"
 const TypeNTPResponse EventType = "ntp-response"
 const TypeNTPError EventType = "ntp-error"
 const TypeBrowserNavigate EventType = "browser-navigate"
+const TypeBrowserRecovery EventType = "browser-recovery"
+const TypeLoad EventType = "load"
+const TypePlay EventType = "play"
+const TypePause EventType = "pause"
+const TypeStop EventType = "stop"
+const TypeUnload EventType = "unload"
+const TypeEnded EventType = "ended"
+const TypeStatus EventType = "status"
+const TypeConnected EventType = "connected"
+const TypeDisconnected EventType = "disconnected"
+const TypeReload EventType = "reload"
+const TypeScreenshot EventType = "screenshot"
+const TypeSetVolume EventType = "set-volume"
+const TypeError EventType = "error"
+const TypeInteraction EventType = "interaction"
+const TypePrefetch EventType = "prefetch"
+const TypeBrowserPreload EventType = "browser-preload"
+const TypeOverlay EventType = "overlay"
+const TypeEmergency EventType = "emergency"
+const TypeEmergencyClear EventType = "emergency-clear"
+const TypeConfigUpdate EventType = "config-update"
+const TypeConfigApplied EventType = "config-applied"
+const TypeHealth EventType = "health"
+const TypeGetLogs EventType = "get-logs"
+const TypeLogs EventType = "logs"
+const TypeLogStream EventType = "log-stream"
+const TypeLog EventType = "log"
+const TypeRestartBrowser EventType = "restart-browser"
+const TypeRestartDisplay EventType = "restart-display"
+const TypeScreenPower EventType = "screen-power"
+const TypeCommandResult EventType = "command-result"
+const TypeMute EventType = "mute"
+const TypeUnmute EventType = "unmute"
+const TypeFadeIn EventType = "fade-in"
+const TypeFadeOut EventType = "fade-out"
@@ -0,0 +1,55 @@
+package genericplayer
+
+import (
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// AudioHandler applies set-volume, mute and unmute events to the system mixer. volume is the
+// value of set-volume. If it returns false, the event is applied to the page instead.
+type AudioHandler func(t event.EventType, volume float64) (bool, error)
+
+// SetAudioHandler enables the control of the system mixer
+func (player *Player) SetAudioHandler(handler AudioHandler) {
+	player.audioHandler.Store(&handler)
+}
+
+// audio validates the volume, mute and fade events and applies them to the system mixer or the page
+func (player *Player) audio(evt *event.Event) {
+	var volume float64
+	switch evt.GetType() {
+	case event.TypeSetVolume:
+		if err := evt.GetPageData(&volume); err != nil {
+			player.reject(evt, errors.Wrap(err, "invalid set-volume"))
+			return
+		}
+		if volume < 0 || volume > 1 {
+			player.reject(evt, errors.Errorf("invalid volume %v", volume))
+			return
+		}
+	case event.TypeFadeIn, event.TypeFadeOut:
+		var fade = &event.Fade{}
+		if err := evt.GetPageData(fade); err != nil {
+			player.reject(evt, errors.Wrapf(err, "invalid %s", evt.GetType()))
+			return
+		}
+		if err := fade.Check(); err != nil {
+			player.reject(evt, err)
+			return
+		}
+		// fades are done by the page
+		player.forward(evt)
+		return
+	}
+	if handler := player.audioHandler.Load(); handler != nil {
+		handled, err := (*handler)(evt.GetType(), volume)
+		if err != nil {
+			player.reject(evt, errors.Wrapf(err, "%s failed", evt.GetType()))
+			return
+		}
+		if handled {
+			return
+		}
+	}
+	player.forward(evt)
+}
@@ -0,0 +1,113 @@
+package genericplayer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"html/template"
+	"net/url"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/browser"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+var emergencyTemplate = template.Must(template.New("emergency").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<style>
+html, body { margin: 0; height: 100%; background: #b00000; color: #fff; font-family: sans-serif; }
+body { display: flex; flex-direction: column; justify-content: center; align-items: center; text-align: center; padding: 5vw; box-sizing: border-box; }
+h1 { font-size: 8vw; margin: 0 0 0.5em 0; }
+p { font-size: 4vw; margin: 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+{{ if .Title }}<h1>{{ .Title }}</h1>{{ end }}
+<p>{{ .Message }}</p>
+</body>
+</html>`))
+
+// emergencyURL renders the emergency as data url
+func emergencyURL(emergency *event.Emergency) (*url.URL, error) {
+	var buf = &bytes.Buffer{}
+	if err := emergencyTemplate.Execute(buf, emergency); err != nil {
+		return nil, errors.Wrap(err, "cannot render emergency")
+	}
+	u, err := url.Parse("data:text/html;charset=utf-8;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return u, errors.Wrap(err, "cannot create emergency url")
+}
+
+// startEmergency pauses the content and shows the emergency above it.
+// A running operator overlay is restored when the emergency ends.
+func (player *Player) startEmergency(evt *event.Event) {
+	var emergency = &event.Emergency{}
+	if err := evt.GetPageData(emergency); err != nil {
+		player.reject(evt, errors.Wrap(err, "invalid emergency"))
+		return
+	}
+	u, err := emergencyURL(emergency)
+	if err != nil {
+		player.reject(evt, err)
+		return
+	}
+	player.emergencyMu.Lock()
+	defer player.emergencyMu.Unlock()
+	if player.emergency == nil {
+		player.emergencyOverlay = player.browser.Overlay()
+		status := player.lastStatus.Load()
+		player.emergencyResume = status != nil && !status.Paused && status.Status == "play"
+	}
+	player.emergency = emergency
+	player.logger.Warn().Msgf("emergency %s: %s", emergency.ID, emergency.Message)
+	if pause, err := event.NewPageEvent(event.TypePause, evt.GetTarget(), nil); err == nil {
+		player.forward(pause)
+	}
+	ctx, cancel := context.WithTimeout(player.ctx, browser.DefaultTaskTimeout)
+	defer cancel()
+	if err := player.browser.ShowOverlay(ctx, u); err != nil {
+		player.reject(evt, err)
+	}
+}
+
+// endEmergency removes the emergency with the id of the event, an empty id matches every emergency
+func (player *Player) endEmergency(evt *event.Event) {
+	var id string
+	if err := evt.GetPageData(&id); err != nil {
+		player.reject(evt, errors.Wrap(err, "invalid emergency id"))
+		return
+	}
+	player.emergencyMu.Lock()
+	defer player.emergencyMu.Unlock()
+	if player.emergency == nil || (id != "" && id != player.emergency.ID) {
+		player.logger.Debug().Msgf("ignoring emergency-clear for %s", id)
+		return
+	}
+	player.logger.Info().Msgf("emergency %s cleared", player.emergency.ID)
+	player.emergency = nil
+	ctx, cancel := context.WithTimeout(player.ctx, browser.DefaultTaskTimeout)
+	defer cancel()
+	var err error
+	if player.emergencyOverlay != nil {
+		err = player.browser.ShowOverlay(ctx, player.emergencyOverlay)
+	} else {
+		err = player.browser.HideOverlay(ctx)
+	}
+	if err != nil {
+		player.reject(evt, err)
+	}
+	player.emergencyOverlay = nil
+	if player.emergencyResume {
+		if play, err := event.NewPageEvent(event.TypePlay, evt.GetTarget(), nil); err == nil {
+			player.forward(play)
+		}
+	}
+}
+
+// inEmergency returns true, if an emergency is shown. Overlays and playback wait until it is cleared.
+func (player *Player) inEmergency() bool {
+	player.emergencyMu.Lock()
+	defer player.emergencyMu.Unlock()
+	return player.emergency != nil
+}
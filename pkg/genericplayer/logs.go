@@ -0,0 +1,132 @@
+package genericplayer
+
+import (
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+)
+
+// SetLogs enables get-logs and log-stream events for the entries of logs
+func (player *Player) SetLogs(logs *logbuffer.Buffer) {
+	player.logs.Store(logs)
+	logs.OnAdd(player.streamLog)
+}
+
+// SetLogSenders sets the clients allowed to send get-logs and log-stream, an empty list denies all.
+// The log streams of other clients are stopped.
+func (player *Player) SetLogSenders(senders []string) {
+	senders = slices.Clone(senders)
+	player.logSenders.Store(&senders)
+	player.logStreamsMu.Lock()
+	defer player.logStreamsMu.Unlock()
+	for name := range player.logStreams {
+		if !slices.Contains(senders, name) {
+			delete(player.logStreams, name)
+		}
+	}
+}
+
+// logSender checks whether the source of the event may read the logs
+func (player *Player) logSender(evt *event.Event) error {
+	senders := player.logSenders.Load()
+	if senders == nil || !slices.Contains(*senders, evt.GetSource()) {
+		return errors.Errorf("%s not allowed to send %s", evt.GetSource(), evt.GetType())
+	}
+	return nil
+}
+
+// getLogs sends the selected entries of the log buffer back to the source of the event
+func (player *Player) getLogs(evt *event.Event) {
+	logs := player.logs.Load()
+	if logs == nil {
+		player.reject(evt, errors.New("get-logs not supported"))
+		return
+	}
+	if err := player.logSender(evt); err != nil {
+		player.reject(evt, err)
+		return
+	}
+	var query = &event.LogQuery{}
+	if len(evt.Data) > 0 {
+		if err := evt.GetPageData(query); err != nil {
+			player.reject(evt, errors.Wrap(err, "invalid get-logs query"))
+			return
+		}
+	}
+	result, err := event.NewEvent(&event.Logs{Entries: logs.Entries(query)}, evt.GetSource(), "")
+	if err != nil {
+		player.logger.Error().Err(err).Msg("cannot create logs event")
+		return
+	}
+	if err := player.comm.Send(result); err != nil {
+		player.logger.Error().Err(err).Msg("Error sending logs event")
+	}
+}
+
+// logStream starts or stops sending the browser console to the source of the event
+func (player *Player) logStream(evt *event.Event) {
+	if player.logs.Load() == nil {
+		player.reject(evt, errors.New("log-stream not supported"))
+		return
+	}
+	if err := player.logSender(evt); err != nil {
+		player.reject(evt, err)
+		return
+	}
+	var stream = &event.LogStream{}
+	if err := evt.GetPageData(stream); err != nil {
+		player.reject(evt, errors.Wrap(err, "invalid log-stream"))
+		return
+	}
+	if evt.GetSource() == "" {
+		return
+	}
+	player.logStreamsMu.Lock()
+	defer player.logStreamsMu.Unlock()
+	if !stream.Enabled {
+		delete(player.logStreams, evt.GetSource())
+		player.logger.Info().Msgf("log stream to %s stopped", evt.GetSource())
+		return
+	}
+	level := stream.Level
+	if level == "" {
+		level = "error"
+	}
+	player.logStreams[evt.GetSource()] = level
+	player.logger.Info().Msgf("log stream to %s started with level %s", evt.GetSource(), level)
+}
+
+// stopLogStream removes the log stream of a disconnected client
+func (player *Player) stopLogStream(name string) {
+	player.logStreamsMu.Lock()
+	defer player.logStreamsMu.Unlock()
+	delete(player.logStreams, name)
+}
+
+// streamLog sends a browser console entry to the subscribed clients. Go entries are not streamed,
+// sending them would log again.
+func (player *Player) streamLog(entry *event.LogEntry) {
+	if entry.Source != event.LogSourceBrowser {
+		return
+	}
+	player.logStreamsMu.Lock()
+	var targets = []string{}
+	for target, level := range player.logStreams {
+		if logbuffer.Enabled(entry.Level, level) {
+			targets = append(targets, target)
+		}
+	}
+	player.logStreamsMu.Unlock()
+	for _, target := range targets {
+		evt, err := event.NewEvent(entry, target, "")
+		if err != nil {
+			player.logger.Error().Err(err).Msg("cannot create log event")
+			return
+		}
+		if err := player.comm.Send(evt); err != nil {
+			player.logger.Error().Err(err).Msgf("Error sending log event to %s", target)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package genericplayer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// TestLogSenders answers get-logs of allowed senders only, the answers are read from the other end of a pipe
+func TestLogSenders(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t))
+	var logger zLogger.ZLogger = &l2
+	displayEnd, proxyEnd := transport.Pipe("display01", "proxy")
+	defer displayEnd.Close()
+	player := &Player{
+		comm:       client.NewCommunication(displayEnd, "display01", logger),
+		logStreams: map[string]string{},
+		logger:     logger,
+	}
+	logs := logbuffer.NewBuffer(10)
+	logs.Add(&event.LogEntry{Time: time.Now(), Source: event.LogSourceBrowser, Level: "error", Message: "token=secret"})
+	player.SetLogs(logs)
+
+	getLogs := &event.Event{Type: event.TypeGetLogs, Source: "page01", Target: "display01"}
+	expect := func(evtType event.EventType) {
+		t.Helper()
+		evt, err := proxyEnd.ReadEvent()
+		if err != nil {
+			t.Fatalf("cannot read event: %v", err)
+		}
+		if evt.GetType() != evtType {
+			t.Fatalf("expected %s, got %s", evtType, evt.GetType())
+		}
+	}
+
+	// without senders nobody gets the logs
+	player.getLogs(getLogs)
+	expect(event.TypeError)
+
+	player.SetLogSenders([]string{"core01"})
+	player.getLogs(getLogs)
+	expect(event.TypeError)
+	player.logStream(&event.Event{Type: event.TypeLogStream, Source: "page01", Target: "display01", Data: []byte(`"{\"enabled\":true}"`)})
+	expect(event.TypeError)
+	if len(player.logStreams) != 0 {
+		t.Fatalf("log stream of page01 started")
+	}
+
+	getLogs.Source = "core01"
+	player.getLogs(getLogs)
+	expect(event.TypeLogs)
+}
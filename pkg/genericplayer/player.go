@@ -4,23 +4,35 @@ import (
 	"context"
 	"encoding/json"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"emperror.dev/errors"
 	"github.com/je4/securedisplay/pkg/browser"
+	"github.com/je4/securedisplay/pkg/cache"
 	"github.com/je4/securedisplay/pkg/client"
 	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/logbuffer"
+	"github.com/je4/securedisplay/pkg/policy"
 	"github.com/je4/utils/v2/pkg/zLogger"
 )
 
-func NewPlayer(ctx context.Context, u *url.URL, browser *browser.Browser, comm *client.Communication, logger zLogger.ZLogger) *Player {
+// NewPlayer creates and runs a player for the page u. Content urls of load and browser-navigate
+// events are checked with contentPolicy, nil allows everything. If contentCache is not nil,
+// prefetched content is played from the local cache.
+func NewPlayer(ctx context.Context, u *url.URL, browser *browser.Browser, comm *client.Communication, contentPolicy *policy.Policy, contentCache *cache.Server, logger zLogger.ZLogger) *Player {
 	p := &Player{
-		browser:   browser,
-		comm:      comm,
-		logger:    logger,
-		url:       u,
-		ctx:       ctx,
-		closeChan: make(chan struct{}),
+		policy:     contentPolicy,
+		cache:      contentCache,
+		browser:    browser,
+		comm:       comm,
+		logger:     logger,
+		ctx:        ctx,
+		closeChan:  make(chan struct{}),
+		logStreams: make(map[string]string),
 	}
+	p.url.Store(u)
 	p.Run()
 	return p
 }
@@ -30,11 +42,40 @@ type Player struct {
 	comm      *client.Communication
 	status    string
 	logger    zLogger.ZLogger
-	url       *url.URL
+	url       atomic.Pointer[url.URL]
 	ctx       context.Context
 	closeChan chan struct{}
+	policy    *policy.Policy
+	cache     *cache.Server
+	// page uses the bridge sdk, no polling needed
+	bridged    atomic.Bool
+	lastStatus atomic.Pointer[PlayerStatus]
+	// emergency is shown, until it is cleared. The overlay before and the playback state are restored.
+	emergency        *event.Emergency
+	emergencyOverlay *url.URL
+	emergencyResume  bool
+	emergencyMu      sync.Mutex
+	// volume is the default volume, which is set after the player page is loaded
+	volume         atomic.Pointer[float64]
+	configHandler  atomic.Pointer[ConfigHandler]
+	commandHandler atomic.Pointer[CommandHandler]
+	audioHandler   atomic.Pointer[AudioHandler]
+	// logs answers get-logs, logStreams are the clients receiving the browser console with their minimum level
+	logs         atomic.Pointer[logbuffer.Buffer]
+	logStreams   map[string]string
+	logStreamsMu sync.Mutex
+	// logSenders are the clients allowed to send get-logs and log-stream
+	logSenders atomic.Pointer[[]string]
 }
 
+// ConfigHandler validates, stores and applies the settings of a config-update event of source.
+// It returns the hash of the resulting configuration.
+type ConfigHandler func(source string, settings *event.Settings) (string, error)
+
+// CommandHandler executes the lifecycle events reload, restart-browser, restart-display and screen-power
+// and reports the result to the source
+type CommandHandler func(evt *event.Event)
+
 type PlayerStatus struct {
 	CurrentTime float64 `json:"currentTime"` // Aktuelle Position in Sekunden
 	Duration    float64 `json:"duration"`    // Gesamtlänge in Sekunden
@@ -47,45 +88,40 @@ type PlayerStatus struct {
 
 func (player *Player) Run() error {
 	player.comm.On(player.event)
+	player.browser.OnBridge(player.bridgeEvent)
+	// the page after a restart may not use the bridge sdk
+	player.browser.OnRestart(func() { player.bridged.Store(false) })
 	if err := player.browser.Run(); err != nil {
 		player.logger.Error().Err(err).Msg("Error starting browser")
 	}
-	if err := player.browser.Navigate(player.url); err != nil {
-		player.logger.Error().Err(err).Msgf("Error navigating to %s", player.url.String())
-	}
+	player.loadPage()
 	go func() {
 		for {
 			select {
 			case <-player.closeChan:
 				return
 			case <-time.After(1 * time.Second):
-				res, err := player.browser.Evaluate("getStatus", "")
+				if player.bridged.Load() {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(player.ctx, 5*time.Second)
+				res, err := player.browser.EvaluateContext(ctx, "getStatus", "")
+				cancel()
 				if err != nil {
+					if browser.IsPageNotReady(err) {
+						player.logger.Debug().Err(err).Msg("page not ready")
+						continue
+					}
 					player.logger.Error().Err(err).Msg("Error getting status")
 					continue
 				}
+				// no status available (i.e. nothing loaded)
 				if res == "" {
 					continue
 				}
-				var obj = &PlayerStatus{}
-				if err := json.Unmarshal([]byte(res), obj); err != nil {
-					player.logger.Error().Err(err).Msg("Error unmarshalling status")
-					continue
+				if err := player.sendStatus([]byte(res)); err != nil {
+					player.logger.Error().Err(err).Msg("Error sending status")
 				}
-				player.logger.Debug().Interface("obj", obj).Msg("Got status")
-				obj.SystemTime += player.comm.ClockOffset.Milliseconds()
-				jsonData, err := json.Marshal(obj)
-				if err != nil {
-					player.logger.Error().Err(err).Msg("Error marshalling status")
-					continue
-				}
-				player.comm.Send(&event.Event{
-					Type:   "status",
-					Source: "",
-					Target: "core",
-					Token:  "",
-					Data:   jsonData,
-				})
 			}
 
 		}
@@ -94,15 +130,383 @@ func (player *Player) Run() error {
 	return nil
 }
 
+func (player *Player) sendStatus(data []byte) error {
+	var obj = &PlayerStatus{}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return errors.Wrap(err, "cannot unmarshal status")
+	}
+	player.logger.Debug().Interface("obj", obj).Msg("Got status")
+	player.lastStatus.Store(obj)
+	obj.SystemTime += player.comm.ClockOffset.Milliseconds()
+	jsonData, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal status")
+	}
+	return player.comm.Send(&event.Event{
+		Type:   event.TypeStatus,
+		Source: "",
+		Target: "core",
+		Token:  "",
+		Data:   jsonData,
+	})
+}
+
+// bridgeEvent receives the messages emitted by the page
+func (player *Player) bridgeEvent(msg *browser.BridgeMessage) {
+	player.bridged.Store(true)
+	player.logger.Debug().Str("type", msg.Type).RawJSON("data", msg.Data).Msg("bridge message")
+	switch msg.Type {
+	case "status":
+		if err := player.sendStatus(msg.Data); err != nil {
+			player.logger.Error().Err(err).Msg("Error sending status")
+		}
+	case string(event.TypeEnded), string(event.TypeError), string(event.TypeInteraction):
+		if err := player.comm.Send(&event.Event{
+			Type:   event.EventType(msg.Type),
+			Source: "",
+			Target: "core",
+			Token:  "",
+			Data:   msg.Data,
+		}); err != nil {
+			player.logger.Error().Err(err).Msgf("Error sending %s event", msg.Type)
+		}
+	default:
+		// pages must not send commands to the displays in core
+		player.logger.Warn().Msgf("bridge message %s dropped", msg.Type)
+	}
+}
+
 func (player *Player) event(evt *event.Event) {
 	player.logger.Debug().Str("type", string(evt.GetType())).Str("source", evt.GetSource()).Str("target", evt.GetTarget()).RawJSON("msg", evt.Data).Msg("event")
 	switch evt.GetType() {
+	case event.TypeStatus, event.TypeEnded, event.TypeError, event.TypeInteraction, event.TypeConnected, event.TypeBrowserRecovery,
+		event.TypeHealth, event.TypeLogs, event.TypeLog, event.TypeCommandResult, event.TypeConfigApplied:
+		// reports of other clients in the core group
+		player.logger.Debug().Msgf("%s event from %s dropped", evt.GetType(), evt.GetSource())
+	case event.TypeDisconnected:
+		var name string
+		_ = json.Unmarshal(evt.Data, &name)
+		player.stopLogStream(name)
+	case event.TypeLoad:
+		if err := player.checkContent(evt); err != nil {
+			player.reject(evt, err)
+			return
+		}
+		player.forward(player.cached(evt))
+	case event.TypePrefetch:
+		player.prefetch(evt)
+	case event.TypeBrowserNavigate:
+		if err := player.checkContent(evt); err != nil {
+			player.reject(evt, err)
+			return
+		}
+		var target string
+		_ = evt.GetPageData(&target)
+		u, _ := url.Parse(target)
+		if err := player.navigate(u); err != nil {
+			player.logger.Error().Err(err).Msgf("Error navigating to %s", target)
+		}
+	case event.TypeBrowserPreload:
+		if err := player.checkContent(evt); err != nil {
+			player.reject(evt, err)
+			return
+		}
+		go player.preload(evt)
+	case event.TypeOverlay:
+		player.overlay(evt)
+	case event.TypeEmergency:
+		player.startEmergency(evt)
+	case event.TypeEmergencyClear:
+		player.endEmergency(evt)
+	case event.TypePlay:
+		if player.inEmergency() {
+			player.reject(evt, errors.New("playback paused by emergency"))
+			return
+		}
+		player.forward(evt)
+	case event.TypePause, event.TypeStop, event.TypeUnload:
+		player.forward(evt)
+	case event.TypeSetVolume, event.TypeMute, event.TypeUnmute, event.TypeFadeIn, event.TypeFadeOut:
+		player.audio(evt)
+	case event.TypeConfigUpdate:
+		player.configUpdate(evt)
+	case event.TypeReload, event.TypeRestartBrowser, event.TypeRestartDisplay, event.TypeScreenPower:
+		handler := player.commandHandler.Load()
+		if handler == nil {
+			player.reject(evt, errors.Errorf("%s not supported", evt.GetType()))
+			return
+		}
+		(*handler)(evt)
+	case event.TypeGetLogs:
+		player.getLogs(evt)
+	case event.TypeLogStream:
+		player.logStream(evt)
+	case event.TypeScreenshot:
+		if err := player.screenshot(evt); err != nil {
+			player.logger.Error().Err(err).Msg("Error sending screenshot")
+		}
 	default:
-		_, err := player.browser.Evaluate("event", evt)
-		if err != nil {
-			player.logger.Error().Err(err).Msg("Error evaluating event")
+		// custom events are handled by the page
+		player.forward(evt)
+	}
+}
+
+// navigate loads u. The status of the new page is polled until it sends a bridge message.
+func (player *Player) navigate(u *url.URL) error {
+	player.bridged.Store(false)
+	return player.browser.Navigate(u)
+}
+
+// forward sends the event to the page
+func (player *Player) forward(evt *event.Event) {
+	var err error
+	if player.bridged.Load() {
+		ctx, cancel := context.WithTimeout(player.ctx, browser.DefaultTaskTimeout)
+		_, err = player.browser.CallBridge(ctx, "event", evt)
+		cancel()
+	} else {
+		_, err = player.browser.Evaluate("event", evt)
+	}
+	if err != nil {
+		player.logger.Error().Err(err).Msg("Error evaluating event")
+	}
+}
+
+// preloadTab is the background tab for browser-preload events
+const preloadTab = "preload"
+
+// preload loads the page of a browser-preload event into the background tab.
+// The next browser-navigate event for the same url swaps the tabs.
+func (player *Player) preload(evt *event.Event) {
+	var target string
+	_ = evt.GetPageData(&target)
+	u, _ := url.Parse(target)
+	// tabs alternate, the visible one is never used
+	name := preloadTab
+	if player.browser.ActiveTab() == preloadTab {
+		name = browser.MainTab
+	}
+	ctx, cancel := context.WithTimeout(player.ctx, browser.DefaultTaskTimeout)
+	defer cancel()
+	if err := player.browser.PreloadContext(ctx, name, u); err != nil {
+		player.reject(evt, err)
+	}
+}
+
+// overlay shows the page of an overlay event above the content. An empty url removes the overlay.
+func (player *Player) overlay(evt *event.Event) {
+	var target string
+	if err := evt.GetPageData(&target); err != nil {
+		player.reject(evt, errors.Wrap(err, "invalid overlay url"))
+		return
+	}
+	var u *url.URL
+	if target != "" {
+		if err := player.checkContent(evt); err != nil {
+			player.reject(evt, err)
+			return
+		}
+		u, _ = url.Parse(target)
+	}
+	player.emergencyMu.Lock()
+	defer player.emergencyMu.Unlock()
+	if player.emergency != nil {
+		// shown after the emergency
+		player.emergencyOverlay = u
+		return
+	}
+	ctx, cancel := context.WithTimeout(player.ctx, browser.DefaultTaskTimeout)
+	defer cancel()
+	if u == nil {
+		if err := player.browser.HideOverlay(ctx); err != nil {
+			player.reject(evt, err)
+		}
+		return
+	}
+	if err := player.browser.ShowOverlay(ctx, u); err != nil {
+		player.reject(evt, err)
+	}
+}
+
+// cached replaces the content url of a load event with the url of the local cache
+func (player *Player) cached(evt *event.Event) *event.Event {
+	if player.cache == nil {
+		return evt
+	}
+	var target string
+	if err := evt.GetPageData(&target); err != nil {
+		return evt
+	}
+	local, ok := player.cache.LocalURL(target)
+	if !ok {
+		return evt
+	}
+	localEvt, err := event.NewPageEvent(evt.GetType(), evt.GetTarget(), local)
+	if err != nil {
+		player.logger.Error().Err(err).Msgf("cannot create load event for %s", local)
+		return evt
+	}
+	localEvt.Source = evt.GetSource()
+	player.logger.Debug().Msgf("playing %s from cache", target)
+	return localEvt
+}
+
+// prefetch loads the announced content into the cache
+func (player *Player) prefetch(evt *event.Event) {
+	if player.cache == nil {
+		player.logger.Debug().Msg("no cache, ignoring prefetch")
+		return
+	}
+	var pf = &event.Prefetch{}
+	if err := evt.GetPageData(pf); err != nil {
+		// a plain url
+		if err := evt.GetPageData(&pf.URL); err != nil {
+			player.reject(evt, errors.Wrap(err, "invalid prefetch data"))
+			return
 		}
+	}
+	if err := player.policy.Check(pf.URL, evt.GetToken()); err != nil {
+		player.reject(evt, err)
+		return
+	}
+	go func() {
+		if err := player.cache.Prefetch(player.ctx, pf.URL, pf.Checksum); err != nil {
+			player.reject(evt, err)
+		}
+	}()
+}
+
+// checkContent checks the url of a load or browser-navigate event with the content policy
+func (player *Player) checkContent(evt *event.Event) error {
+	var target string
+	if err := evt.GetPageData(&target); err != nil {
+		return errors.Wrapf(policy.ErrNotAllowed, "invalid url in %s event: %v", evt.GetType(), err)
+	}
+	return player.policy.Check(target, evt.GetToken())
+}
+
+// reject informs core about a refused or failed event
+func (player *Player) reject(evt *event.Event, err error) {
+	player.logger.Warn().Err(err).Msgf("%s event from %s failed", evt.GetType(), evt.GetSource())
+	jsonData, _ := json.Marshal(err.Error())
+	if err := player.comm.Send(&event.Event{
+		Type:   event.TypeError,
+		Source: "",
+		Target: "core",
+		Token:  "",
+		Data:   jsonData,
+	}); err != nil {
+		player.logger.Error().Err(err).Msg("Error sending error event")
+	}
+}
+
+// screenshot sends a screenshot of the page back to the source of the event
+func (player *Player) screenshot(evt *event.Event) error {
+	var params = struct {
+		Width int `json:"width"`
+	}{}
+	if len(evt.Data) > 0 {
+		if err := evt.GetPageData(&params); err != nil {
+			player.logger.Warn().Err(err).Msg("invalid screenshot parameters")
+		}
+	}
+	img, mimeType, err := player.browser.Screenshot(params.Width, 0, 0)
+	if err != nil {
+		return errors.Wrap(err, "cannot take screenshot")
+	}
+	result, err := event.NewEvent(&event.Screenshot{
+		MimeType: mimeType,
+		Image:    img,
+	}, evt.GetSource(), "")
+	if err != nil {
+		return errors.Wrap(err, "cannot create screenshot event")
+	}
+	return player.comm.Send(result)
+}
+
+// SetURL changes the player page and loads it
+func (player *Player) SetURL(u *url.URL) error {
+	old := player.url.Swap(u)
+	if old != nil && old.String() == u.String() {
+		return nil
+	}
+	if err := player.navigate(u); err != nil {
+		return errors.Wrapf(err, "cannot navigate to %s", u.String())
+	}
+	player.sendVolume()
+	return nil
+}
+
+// loadPage navigates to the player page
+func (player *Player) loadPage() {
+	if err := player.Reload(); err != nil {
+		player.logger.Error().Err(err).Msg("Error loading player page")
+	}
+}
+
+// Reload loads the player page again
+func (player *Player) Reload() error {
+	u := player.url.Load()
+	if err := player.navigate(u); err != nil {
+		return errors.Wrapf(err, "cannot navigate to %s", u.String())
+	}
+	player.sendVolume()
+	return nil
+}
+
+// SetVolume sets the default volume of the player page. It is applied immediately and after every page load.
+func (player *Player) SetVolume(volume float64) {
+	player.volume.Store(&volume)
+	player.sendVolume()
+}
 
+func (player *Player) sendVolume() {
+	volume := player.volume.Load()
+	if volume == nil {
+		return
+	}
+	evt, err := event.NewPageEvent(event.TypeSetVolume, player.comm.Name(), *volume)
+	if err != nil {
+		player.logger.Error().Err(err).Msg("cannot create set-volume event")
+		return
+	}
+	player.forward(evt)
+}
+
+// SetConfigHandler enables config-update events
+func (player *Player) SetConfigHandler(handler ConfigHandler) {
+	player.configHandler.Store(&handler)
+}
+
+// SetCommandHandler enables reload, restart-browser, restart-display and screen-power events
+func (player *Player) SetCommandHandler(handler CommandHandler) {
+	player.commandHandler.Store(&handler)
+}
+
+// configUpdate applies the settings of a config-update event and acknowledges it with the hash of the configuration
+func (player *Player) configUpdate(evt *event.Event) {
+	handler := player.configHandler.Load()
+	if handler == nil {
+		player.reject(evt, errors.New("config-update not supported"))
+		return
+	}
+	var settings = &event.Settings{}
+	if err := evt.GetPageData(settings); err != nil {
+		player.reject(evt, errors.Wrap(err, "invalid config-update"))
+		return
+	}
+	hash, err := (*handler)(evt.GetSource(), settings)
+	if err != nil {
+		player.reject(evt, errors.Wrap(err, "config-update failed"))
+		return
+	}
+	applied, err := event.NewEvent(&event.ConfigApplied{Hash: hash}, evt.GetSource(), "")
+	if err != nil {
+		player.logger.Error().Err(err).Msg("cannot create config-applied event")
+		return
+	}
+	if err := player.comm.Send(applied); err != nil {
+		player.logger.Error().Err(err).Msg("Error sending config-applied event")
 	}
 }
 
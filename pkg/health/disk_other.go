@@ -0,0 +1,8 @@
+//go:build !unix
+
+package health
+
+// disk is not supported on this system
+func disk(path string) (uint64, uint64) {
+	return 0, 0
+}
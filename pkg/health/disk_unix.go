@@ -0,0 +1,14 @@
+//go:build unix
+
+package health
+
+import "syscall"
+
+// disk returns the size and the free space of the filesystem of path in bytes
+func disk(path string) (uint64, uint64) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0
+	}
+	return uint64(stat.Blocks) * uint64(stat.Bsize), uint64(stat.Bavail) * uint64(stat.Bsize)
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+var processStart = time.Now()
+
+// Collect returns the health of the system. diskPath selects the filesystem of the disk values.
+// Values, which are not available on the system, are left empty.
+func Collect(diskPath string) *event.Health {
+	h := &event.Health{
+		Time:   time.Now(),
+		Uptime: time.Since(processStart).Seconds(),
+	}
+	h.Hostname, _ = os.Hostname()
+	h.Load1, h.Load5, h.Load15 = loadAverage()
+	h.MemTotal, h.MemAvailable = memory()
+	h.DiskTotal, h.DiskFree = disk(diskPath)
+	h.CPUTemperature = cpuTemperature()
+	h.SystemUptime = systemUptime()
+	h.Interfaces = interfaces()
+	return h
+}
+
+func loadAverage() (float64, float64, float64) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, 0, 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0
+	}
+	var loads [3]float64
+	for i := range loads {
+		loads[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return loads[0], loads[1], loads[2]
+}
+
+// memory returns total and available memory in bytes
+func memory() (uint64, uint64) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	var total, available uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16318412 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value * 1024
+		case "MemAvailable:":
+			available = value * 1024
+		}
+	}
+	return total, available
+}
+
+// cpuTemperature returns the highest temperature of the thermal zones
+func cpuTemperature() float64 {
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	var highest float64
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+		if err != nil {
+			continue
+		}
+		// millidegree celsius
+		milli, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			continue
+		}
+		if temp := milli / 1000; temp > highest {
+			highest = temp
+		}
+	}
+	return highest
+}
+
+func systemUptime() float64 {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	return uptime
+}
+
+// interfaces returns the network interfaces without loopback
+func interfaces() []*event.NetInterface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result = []*event.NetInterface{}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ni := &event.NetInterface{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ni.Addrs = append(ni.Addrs, addr.String())
+		}
+		result = append(result, ni)
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// MetricsFunc returns the performance metrics of the browser
+type MetricsFunc func(deadline time.Duration) (map[string]float64, error)
+
+// NewReporter creates a reporter, which collects the health every interval and passes it to report.
+// metrics may be nil, if there is no browser.
+func NewReporter(interval time.Duration, diskPath string, metrics MetricsFunc, report func(*event.Health), logger zLogger.ZLogger) *Reporter {
+	if interval == 0 {
+		interval = time.Minute
+	}
+	if diskPath == "" {
+		diskPath = "/"
+	}
+	return &Reporter{
+		interval:  interval,
+		diskPath:  diskPath,
+		metrics:   metrics,
+		report:    report,
+		logger:    logger,
+		closeChan: make(chan struct{}),
+	}
+}
+
+type Reporter struct {
+	interval  time.Duration
+	diskPath  string
+	metrics   MetricsFunc
+	report    func(*event.Health)
+	logger    zLogger.ZLogger
+	closeChan chan struct{}
+	wg        sync.WaitGroup
+}
+
+func (r *Reporter) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Reporter) Stop() {
+	close(r.closeChan)
+	r.wg.Wait()
+}
+
+func (r *Reporter) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.report(r.collect())
+		select {
+		case <-r.closeChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Reporter) collect() *event.Health {
+	h := Collect(r.diskPath)
+	if r.metrics != nil {
+		metrics, err := r.metrics(5 * time.Second)
+		if err != nil {
+			r.logger.Debug().Err(err).Msg("cannot get browser metrics")
+		} else {
+			h.Browser = metrics
+		}
+	}
+	return h
+}
@@ -0,0 +1,105 @@
+package logbuffer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/rs/zerolog"
+)
+
+// NewBuffer creates a ring buffer, which keeps the last size log entries
+func NewBuffer(size int) *Buffer {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Buffer{
+		entries: make([]*event.LogEntry, 0, size),
+		size:    size,
+	}
+}
+
+// Buffer keeps the recent entries of the display log and the browser console.
+// As zerolog hook it records the messages of a logger.
+type Buffer struct {
+	mu      sync.Mutex
+	entries []*event.LogEntry
+	// next is the position of the oldest entry, once the buffer is full
+	next  int
+	size  int
+	onAdd func(*event.LogEntry)
+}
+
+// OnAdd sets a function, which is called for every new entry
+func (b *Buffer) OnAdd(f func(*event.LogEntry)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onAdd = f
+}
+
+func (b *Buffer) Add(entry *event.LogEntry) {
+	b.mu.Lock()
+	if len(b.entries) < b.size {
+		b.entries = append(b.entries, entry)
+	} else {
+		b.entries[b.next] = entry
+		b.next = (b.next + 1) % b.size
+	}
+	onAdd := b.onAdd
+	b.mu.Unlock()
+	if onAdd != nil {
+		onAdd(entry)
+	}
+}
+
+// Entries returns the entries selected by query, oldest first
+func (b *Buffer) Entries(query *event.LogQuery) []*event.LogEntry {
+	b.mu.Lock()
+	all := append(append([]*event.LogEntry{}, b.entries[b.next:]...), b.entries[:b.next]...)
+	b.mu.Unlock()
+	var result = []*event.LogEntry{}
+	for _, entry := range all {
+		if query.Source != "" && entry.Source != query.Source {
+			continue
+		}
+		if !Enabled(entry.Level, query.Level) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[len(result)-query.Limit:]
+	}
+	return result
+}
+
+// Run records the messages of the logger as go entries
+func (b *Buffer) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	if level == zerolog.NoLevel || level == zerolog.Disabled {
+		return
+	}
+	b.Add(&event.LogEntry{
+		Time:    time.Now(),
+		Source:  event.LogSourceGo,
+		Level:   level.String(),
+		Message: message,
+	})
+}
+
+var _ zerolog.Hook = (*Buffer)(nil)
+
+// Enabled checks whether level is at least minLevel. Unknown levels are always enabled.
+func Enabled(level, minLevel string) bool {
+	if minLevel == "" {
+		return true
+	}
+	l, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return true
+	}
+	minL, err := zerolog.ParseLevel(minLevel)
+	if err != nil {
+		return true
+	}
+	return l >= minL
+}
@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// Manifest describes a content url, which is released by the owner of a signing key
+type Manifest struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// SignManifest creates a token of the form base64(manifest).base64(signature).
+// The token is sent in the token field of load and browser-navigate events.
+func SignManifest(key ed25519.PrivateKey, m *Manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal manifest")
+	}
+	sig := ed25519.Sign(key, data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseManifest verifies the signature of a token with the trusted keys and returns its manifest
+func ParseManifest(token string, keys []ed25519.PublicKey) (*Manifest, error) {
+	dataStr, sigStr, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.New("invalid manifest token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(dataStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode manifest")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode manifest signature")
+	}
+	var verified bool
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("manifest not signed by a trusted key")
+	}
+	var m = &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal manifest")
+	}
+	return m, nil
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key
+func ParsePublicKey(str string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decode public key %s", str)
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid public key size %d", len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// ParsePrivateKey decodes a base64 encoded ed25519 private key or seed
+func ParsePrivateKey(str string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode private key")
+	}
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	default:
+		return nil, errors.Errorf("invalid private key size %d", len(data))
+	}
+}
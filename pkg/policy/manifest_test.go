@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	return pub, priv
+}
+
+func TestCheckManifest(t *testing.T) {
+	trustedPub, trustedPriv := newKey(t)
+	_, otherPriv := newKey(t)
+	const contentURL = "https://content.example.com/video.html"
+	sign := func(key ed25519.PrivateKey, m *Manifest) string {
+		token, err := SignManifest(key, m)
+		if err != nil {
+			t.Fatalf("cannot sign manifest: %v", err)
+		}
+		return token
+	}
+	valid := sign(trustedPriv, &Manifest{URL: contentURL, Expires: time.Now().Add(time.Hour)})
+	data, sig, _ := strings.Cut(valid, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"url":"https://evil.example.com/"}`)) + "." + sig
+
+	p, err := NewPolicy(nil, []string{base64.StdEncoding.EncodeToString(trustedPub)}, true)
+	if err != nil {
+		t.Fatalf("cannot create policy: %v", err)
+	}
+	for _, test := range []struct {
+		name  string
+		url   string
+		token string
+		ok    bool
+	}{
+		{"valid", contentURL, valid, true},
+		{"without expiry", contentURL, sign(trustedPriv, &Manifest{URL: contentURL}), true},
+		{"expired", contentURL, sign(trustedPriv, &Manifest{URL: contentURL, Expires: time.Now().Add(-time.Minute)}), false},
+		{"wrong key", contentURL, sign(otherPriv, &Manifest{URL: contentURL}), false},
+		{"other url", "https://content.example.com/other.html", valid, false},
+		{"tampered", "https://evil.example.com/", tampered, false},
+		{"no signature", contentURL, data, false},
+		{"no token", contentURL, "", false},
+	} {
+		err := p.Check(test.url, test.token)
+		if test.ok && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: manifest accepted", test.name)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv := newKey(t)
+	if _, err := ParsePublicKey(" " + base64.StdEncoding.EncodeToString(pub) + "\n"); err != nil {
+		t.Errorf("cannot parse public key: %v", err)
+	}
+	if _, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub[:16])); err == nil {
+		t.Error("short public key accepted")
+	}
+	for _, data := range [][]byte{priv, priv.Seed()} {
+		key, err := ParsePrivateKey(base64.StdEncoding.EncodeToString(data))
+		if err != nil {
+			t.Fatalf("cannot parse private key of size %d: %v", len(data), err)
+		}
+		if !key.Public().(ed25519.PublicKey).Equal(pub) {
+			t.Errorf("private key of size %d does not match", len(data))
+		}
+	}
+	if _, err := NewPolicy(nil, nil, true); err == nil {
+		t.Error("signature required without trusted keys accepted")
+	}
+}
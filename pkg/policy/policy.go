@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// ErrNotAllowed is returned for content, which is not allowed on the display
+var ErrNotAllowed = errors.New("content not allowed")
+
+// NewPolicy creates a content policy. Origins are written as scheme://host[:port], a host may
+// start with "*." to allow all subdomains. An empty list allows all origins.
+// Keys are base64 encoded ed25519 public keys.
+func NewPolicy(origins []string, keys []string, requireSignature bool) (*Policy, error) {
+	p := &Policy{
+		origins:          []*url.URL{},
+		keys:             []ed25519.PublicKey{},
+		requireSignature: requireSignature,
+	}
+	for _, origin := range origins {
+		if err := p.AddOrigin(origin); err != nil {
+			return nil, err
+		}
+	}
+	for _, keyStr := range keys {
+		key, err := ParsePublicKey(keyStr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid trusted key")
+		}
+		p.keys = append(p.keys, key)
+	}
+	if requireSignature && len(p.keys) == 0 {
+		return nil, errors.New("signature required, but no trusted keys")
+	}
+	return p, nil
+}
+
+// Policy decides which urls may be shown on a display
+type Policy struct {
+	origins          []*url.URL
+	keys             []ed25519.PublicKey
+	requireSignature bool
+	mu               sync.RWMutex
+}
+
+// Update replaces the rules of the policy. On error, the policy is not changed.
+func (p *Policy) Update(origins []string, keys []string, requireSignature bool) error {
+	newPolicy, err := NewPolicy(origins, keys, requireSignature)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins = newPolicy.origins
+	p.keys = newPolicy.keys
+	p.requireSignature = newPolicy.requireSignature
+	return nil
+}
+
+// Restricted returns true, if the policy has an origin allowlist
+func (p *Policy) Restricted() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.origins) > 0
+}
+
+// AddOrigin allows an additional origin like the one of the player page
+func (p *Policy) AddOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return errors.Wrapf(err, "invalid origin %s", origin)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.Errorf("invalid origin %s, scheme://host expected", origin)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins = append(p.origins, &url.URL{Scheme: strings.ToLower(u.Scheme), Host: strings.ToLower(u.Host)})
+	return nil
+}
+
+// AllowOrigin checks whether the origin of u is in the allowlist
+func (p *Policy) AllowOrigin(u *url.URL) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.origins) == 0 {
+		return true
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	for _, origin := range p.origins {
+		if origin.Scheme != scheme {
+			continue
+		}
+		if origin.Host == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(origin.Host, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check verifies that the content url is allowed and, if required, signed by token
+func (p *Policy) Check(rawURL string, token string) error {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrapf(ErrNotAllowed, "invalid url %s: %v", rawURL, err)
+	}
+	if !p.AllowOrigin(u) {
+		return errors.Wrapf(ErrNotAllowed, "origin of %s not in allowlist", rawURL)
+	}
+	p.mu.RLock()
+	requireSignature, keys := p.requireSignature, p.keys
+	p.mu.RUnlock()
+	if !requireSignature {
+		return nil
+	}
+	if token == "" {
+		return errors.Wrapf(ErrNotAllowed, "no manifest for %s", rawURL)
+	}
+	m, err := ParseManifest(token, keys)
+	if err != nil {
+		return errors.Wrapf(ErrNotAllowed, "invalid manifest for %s: %v", rawURL, err)
+	}
+	if m.URL != rawURL {
+		return errors.Wrapf(ErrNotAllowed, "manifest for %s does not match %s", m.URL, rawURL)
+	}
+	if !m.Expires.IsZero() && time.Now().After(m.Expires) {
+		return errors.Wrapf(ErrNotAllowed, "manifest for %s expired at %s", rawURL, m.Expires)
+	}
+	return nil
+}
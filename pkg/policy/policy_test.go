@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAllowOrigin(t *testing.T) {
+	p, err := NewPolicy([]string{"https://Content.Example.com", "https://*.cdn.example.com", "http://localhost:7081"}, nil, false)
+	if err != nil {
+		t.Fatalf("cannot create policy: %v", err)
+	}
+	for _, test := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://content.example.com/video.html", true},
+		{"HTTPS://CONTENT.EXAMPLE.COM/video.html", true},
+		{"http://content.example.com/video.html", false},
+		{"https://content.example.com:8443/video.html", false},
+		{"https://evil.com/?https://content.example.com", false},
+		{"https://content.example.com.evil.com/", false},
+		{"https://a.cdn.example.com/clip.mp4", true},
+		{"https://a.b.cdn.example.com/clip.mp4", true},
+		{"https://cdn.example.com/clip.mp4", false},
+		{"https://evilcdn.example.com/clip.mp4", false},
+		{"http://localhost:7081/roundaudio", true},
+		{"http://localhost/roundaudio", false},
+		{"data:text/html,<h1>x</h1>", false},
+	} {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %v", test.url, err)
+		}
+		if allowed := p.AllowOrigin(u); allowed != test.allowed {
+			t.Errorf("%s: expected allowed %v, got %v", test.url, test.allowed, allowed)
+		}
+	}
+}
+
+func TestInvalidOrigins(t *testing.T) {
+	for _, origin := range []string{"content.example.com", "https://", "://content.example.com"} {
+		if _, err := NewPolicy([]string{origin}, nil, false); err == nil {
+			t.Errorf("invalid origin %s accepted", origin)
+		}
+	}
+	// an empty allowlist allows every origin
+	p, err := NewPolicy(nil, nil, false)
+	if err != nil {
+		t.Fatalf("cannot create policy: %v", err)
+	}
+	if p.Restricted() || p.Check("https://any.example.com/", "") != nil {
+		t.Error("empty allowlist is restricted")
+	}
+}
@@ -0,0 +1,201 @@
+package provision
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+)
+
+// Request is sent by a display with a bootstrap certificate to the provision endpoint
+type Request struct {
+	Hostname string `json:"hostname"`
+	// CSR is the PEM encoded certificate request of the display key
+	CSR string `json:"csr"`
+}
+
+// Ticket is the answer to a Request. The pairing code is shown on the display and entered by the operator.
+type Ticket struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+// Result is returned to the display after the approval
+type Result struct {
+	Status Status   `json:"status"`
+	Name   string   `json:"name,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Certificate is the PEM encoded client certificate
+	Certificate string `json:"certificate,omitempty"`
+	// Config is the toml configuration for the display
+	Config string `json:"config,omitempty"`
+}
+
+// CA signs the certificates of the provisioned displays
+type CA struct {
+	cert *x509.Certificate
+	key  any
+}
+
+// LoadCA reads the PEM encoded certificate and private key of the signing CA
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load ca %s", certFile)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse ca %s", certFile)
+	}
+	if !cert.IsCA {
+		return nil, errors.Errorf("%s is not a ca certificate", certFile)
+	}
+	return &CA{
+		cert: cert,
+		key:  pair.PrivateKey,
+	}, nil
+}
+
+// Sign creates a client certificate for the display name. The groups are added as SAN URIs
+// with uriScheme, an empty uriScheme omits them.
+func (ca *CA) Sign(csrPEM string, name string, groups []string, uriScheme string, validity time.Duration) ([]byte, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse certificate request")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "invalid certificate request signature")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate serial")
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"ws:" + name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uriScheme != "" {
+		for _, group := range groups {
+			template.URIs = append(template.URIs, &url.URL{Scheme: uriScheme, Opaque: group})
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create certificate for %s", name)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+const (
+	keyFile    = "key.pem"
+	certFile   = "cert.pem"
+	configFile = "display.toml"
+)
+
+// NewKey creates the private key of a display and its certificate request, both PEM encoded
+func NewKey(hostname string) (keyPEM []byte, csrPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot generate key")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot marshal key")
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: hostname},
+	}, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create certificate request")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), nil
+}
+
+// Identity is the certificate and configuration of a provisioned display
+type Identity struct {
+	Name        string
+	Certificate tls.Certificate
+	Config      string
+}
+
+// Save writes the key and the result of the approval to dir
+func Save(dir string, keyPEM []byte, result *Result) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "cannot create %s", dir)
+	}
+	// the certificate is written last, it marks the display as provisioned
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{keyFile, keyPEM},
+		{configFile, []byte(result.Config)},
+		{certFile, []byte(result.Certificate)},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file.name), file.data, 0600); err != nil {
+			return errors.Wrapf(err, "cannot write %s", file.name)
+		}
+	}
+	return nil
+}
+
+// Load reads the identity from dir. It returns nil without error, if the display is not provisioned.
+func Load(dir string) (*Identity, error) {
+	if _, err := os.Stat(filepath.Join(dir, certFile)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, certFile), filepath.Join(dir, keyFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot load certificate from %s", dir)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse certificate from %s", dir)
+	}
+	identity := &Identity{}
+	for _, dnsName := range cert.DNSNames {
+		if name, ok := strings.CutPrefix(dnsName, "ws:"); ok {
+			identity.Name = name
+			break
+		}
+	}
+	if identity.Name == "" {
+		return nil, errors.Errorf("no ws:<name> in certificate %s", filepath.Join(dir, certFile))
+	}
+	config, err := os.ReadFile(filepath.Join(dir, configFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrapf(err, "cannot read %s", configFile)
+	}
+	identity.Config = string(config)
+	identity.Certificate = pair
+	return identity, nil
+}
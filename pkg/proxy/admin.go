@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// adminOnly aborts requests of clients without an admin certificate
+func (srv *SocketServer) adminOnly(c *gin.Context) {
+	var names = []string{}
+	if namesAny, ok := c.Get("names"); ok {
+		names = namesAny.([]string)
+	}
+	if srv.isAdmin(names) {
+		c.Next()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin certificate required"})
+}
+
+// auditEnabled aborts requests, if there is no audit log
+func (srv *SocketServer) auditEnabled(c *gin.Context) {
+	if srv.auditLog == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "audit log disabled"})
+		return
+	}
+	c.Next()
+}
+
+// auditQuery returns the entries of the audit log matching the query parameters
+// source, operator, target, type, from, to (RFC3339) and limit
+func (srv *SocketServer) auditQuery(c *gin.Context) {
+	var filter = &AuditFilter{
+		Source:   c.Query("source"),
+		Operator: c.Query("operator"),
+		Target:   c.Query("target"),
+		Type:     event.EventType(c.Query("type")),
+		Limit:    1000,
+	}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: " + err.Error()})
+			return
+		}
+	}
+	entries, err := srv.auditLog.Query(filter)
+	if err != nil {
+		srv.logger.Error().Err(err).Msg("cannot query audit log")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (srv *SocketServer) auditVerify(c *gin.Context) {
+	count, err := srv.auditLog.Verify()
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"valid": false, "entries": count, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"valid": true, "entries": count})
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/provision"
+)
+
+// TestRoutesGatedAtRequestTime checks that audit and provisioning routes exist without being enabled at start
+func TestRoutesGatedAtRequestTime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := newTestServer(t)
+	handler := srv.handler()
+	request := func(method, path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code
+	}
+
+	for _, path := range []string{"/api/audit", "/api/provision", "/admin/provision"} {
+		if code := request(http.MethodGet, path); code != http.StatusNotFound {
+			t.Fatalf("%s disabled: expected %d, got %d", path, http.StatusNotFound, code)
+		}
+	}
+	srv.SetProvisioning(&Provisioning{BootstrapNames: []string{"bootstrap"}})
+	for _, path := range []string{"/api/provision", "/admin/provision"} {
+		if code := request(http.MethodGet, path); code != http.StatusForbidden {
+			t.Fatalf("%s enabled without admin: expected %d, got %d", path, http.StatusForbidden, code)
+		}
+	}
+	if code := request(http.MethodPost, "/provision"); code != http.StatusForbidden {
+		t.Fatalf("/provision without bootstrap certificate: expected %d, got %d", http.StatusForbidden, code)
+	}
+	srv.SetProvisioning(nil)
+	if code := request(http.MethodPost, "/provision"); code != http.StatusNotFound {
+		t.Fatalf("/provision disabled: expected %d, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestProvisioningNames(t *testing.T) {
+	srv := newTestServer(t)
+	provisioning := &Provisioning{ReservedNames: []string{"core01"}}
+	srv.AddToGroup("display01", "lobby")
+	srv.provisioner.requests["1"] = &provisionRequest{ID: "1", Status: provision.StatusApproved, Name: "display02"}
+
+	for name, reason := range map[string]string{
+		"core01":    "reserved",
+		"display01": "in use",
+		"display02": "already approved",
+		"display03": "",
+	} {
+		if got, _ := srv.nameTaken(name, provisioning); got != reason {
+			t.Fatalf("%s: expected %q, got %q", name, reason, got)
+		}
+	}
+}
+
+func TestProvisionAdmins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := newTestServer(t)
+	// the admins of the audit log cannot approve displays
+	srv.SetAdmins([]string{"ws:admin"})
+	request := func(names []string) int {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Set("provisioning", srv.getProvisioning())
+		c.Set("names", names)
+		srv.provisionAdminOnly(c)
+		if c.IsAborted() {
+			return rec.Code
+		}
+		return http.StatusOK
+	}
+	srv.SetProvisioning(&Provisioning{})
+	if code := request([]string{"ws:admin"}); code != http.StatusForbidden {
+		t.Fatalf("empty provisioning admins: expected %d, got %d", http.StatusForbidden, code)
+	}
+	srv.SetProvisioning(&Provisioning{Admins: []string{"ws:installer"}})
+	if code := request([]string{"ws:admin"}); code != http.StatusForbidden {
+		t.Fatalf("audit admin: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code := request([]string{"ws:installer"}); code != http.StatusOK {
+		t.Fatalf("provisioning admin: expected %d, got %d", http.StatusOK, code)
+	}
+}
@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+type AuditOutcome string
+
+const (
+	AuditDelivered AuditOutcome = "delivered"
+	AuditQueued    AuditOutcome = "queued"
+	AuditFailed    AuditOutcome = "failed"
+	AuditRejected  AuditOutcome = "rejected"
+	// AuditApplied is the outcome of events handled by the proxy itself like attach
+	AuditApplied AuditOutcome = "applied"
+)
+
+// AuditEntry is a line of the audit log. Hash is the sha256 of the entry with an empty Hash,
+// which contains the hash of the previous entry.
+type AuditEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Source is the authenticated name of the sending connection
+	Source string `json:"source"`
+	// ClaimedSource is the source field of the event, if it differs from Source
+	ClaimedSource string `json:"claimedSource,omitempty"`
+	// Operator is the person, who issued the event at the core
+	Operator    string          `json:"operator,omitempty"`
+	Target      string          `json:"target"`
+	Destination string          `json:"destination,omitempty"`
+	Type        event.EventType `json:"type"`
+	Digest      string          `json:"digest"`
+	Outcome     AuditOutcome    `json:"outcome"`
+	Error       string          `json:"error,omitempty"`
+	PrevHash    string          `json:"prevHash"`
+	Hash        string          `json:"hash"`
+}
+
+func (entry *AuditEntry) calcHash() (string, error) {
+	e := *entry
+	e.Hash = ""
+	data, err := json.Marshal(&e)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal audit entry")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditFilter selects entries of the audit log. Empty fields match everything.
+type AuditFilter struct {
+	Source   string
+	Operator string
+	Target   string
+	Type     event.EventType
+	From     time.Time
+	To       time.Time
+	// Limit returns only the last Limit matching entries
+	Limit int
+}
+
+func (f *AuditFilter) match(entry *AuditEntry) bool {
+	switch {
+	case f.Source != "" && f.Source != entry.Source:
+		return false
+	case f.Operator != "" && f.Operator != entry.Operator:
+		return false
+	case f.Target != "" && f.Target != entry.Target && f.Target != entry.Destination:
+		return false
+	case f.Type != "" && f.Type != entry.Type:
+		return false
+	case !f.From.IsZero() && entry.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && entry.Time.After(f.To):
+		return false
+	}
+	return true
+}
+
+// ErrAuditNotSynced is returned by Log for an entry, which is written, but not synced to disk
+var ErrAuditNotSynced = errors.New("audit entry not synced")
+
+// NewAuditLog opens the audit log at path and continues its hash chain.
+// New entries are synced to disk every syncInterval, 0 syncs every entry.
+func NewAuditLog(path string, syncInterval time.Duration, logger zLogger.ZLogger) (*AuditLog, error) {
+	a := &AuditLog{path: path, syncInterval: syncInterval, logger: logger}
+	if err := a.scan(func(entry *AuditEntry) bool {
+		a.seq = entry.Seq
+		a.lastHash = entry.Hash
+		return true
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot read audit log %s", path)
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open audit log %s", path)
+	}
+	a.fp = fp
+	if syncInterval > 0 {
+		a.done = make(chan struct{})
+		a.wg.Add(1)
+		go a.syncLoop()
+	}
+	return a, nil
+}
+
+// AuditLog is an append-only json lines file of hash chained entries
+type AuditLog struct {
+	path     string
+	fp       *os.File
+	mu       sync.Mutex
+	seq      uint64
+	lastHash string
+	// syncInterval batches the syncs of the entries written in between, dirty marks unsynced entries
+	syncInterval time.Duration
+	dirty        bool
+	done         chan struct{}
+	wg           sync.WaitGroup
+	logger       zLogger.ZLogger
+}
+
+// syncLoop syncs the written entries every syncInterval
+func (a *AuditLog) syncLoop() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			if err := a.sync(); err != nil {
+				// the entries are synced with the next tick
+				a.logger.Error().Err(err).Msg("cannot sync audit log")
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// sync writes unsynced entries to disk. mu must be held by the caller.
+func (a *AuditLog) sync() error {
+	if !a.dirty {
+		return nil
+	}
+	if err := a.fp.Sync(); err != nil {
+		return errors.Wrapf(err, "cannot sync audit log %s", a.path)
+	}
+	a.dirty = false
+	return nil
+}
+
+func (a *AuditLog) Close() error {
+	if a.done != nil {
+		close(a.done)
+		a.wg.Wait()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.sync(); err != nil {
+		a.fp.Close()
+		return err
+	}
+	return errors.WithStack(a.fp.Close())
+}
+
+// Log appends an entry for evt. source is the authenticated name of the sender.
+func (a *AuditLog) Log(source string, dest string, evt *event.Event, outcome AuditOutcome, auditErr error) error {
+	sum := sha256.Sum256(evt.Data)
+	entry := &AuditEntry{
+		Time:        time.Now().UTC(),
+		Source:      source,
+		Operator:    evt.Operator,
+		Target:      evt.GetTarget(),
+		Destination: dest,
+		Type:        evt.GetType(),
+		Digest:      hex.EncodeToString(sum[:]),
+		Outcome:     outcome,
+	}
+	if evt.GetSource() != source {
+		entry.ClaimedSource = evt.GetSource()
+	}
+	if auditErr != nil {
+		entry.Error = auditErr.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Seq = a.seq + 1
+	entry.PrevHash = a.lastHash
+	hash, err := entry.calcHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal audit entry")
+	}
+	if _, err := a.fp.Write(append(data, '\n')); err != nil {
+		return errors.Wrapf(err, "cannot write to audit log %s", a.path)
+	}
+	// the entry is written, the next one is chained to it even if the sync fails
+	a.seq = entry.Seq
+	a.lastHash = entry.Hash
+	a.dirty = true
+	if a.syncInterval <= 0 {
+		if err := a.sync(); err != nil {
+			return errors.Wrap(ErrAuditNotSynced, err.Error())
+		}
+	}
+	return nil
+}
+
+// scan calls fn for every entry of the log file until fn returns false
+func (a *AuditLog) scan(fn func(entry *AuditEntry) bool) error {
+	fp, err := os.Open(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	defer fp.Close()
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry = &AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return errors.Wrapf(err, "invalid audit entry in line %d", line)
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+	return errors.WithStack(scanner.Err())
+}
+
+// Query returns the matching entries of the log
+func (a *AuditLog) Query(filter *AuditFilter) ([]*AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var result = []*AuditEntry{}
+	if err := a.scan(func(entry *AuditEntry) bool {
+		if filter.match(entry) {
+			result = append(result, entry)
+			if filter.Limit > 0 && len(result) > filter.Limit {
+				result = result[1:]
+			}
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrapf(err, "cannot query audit log %s", a.path)
+	}
+	return result, nil
+}
+
+// Verify checks the hash chain of the log and returns the number of valid entries
+func (a *AuditLog) Verify() (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var count uint64
+	var prevHash string
+	var verifyErr error
+	if err := a.scan(func(entry *AuditEntry) bool {
+		hash, err := entry.calcHash()
+		switch {
+		case err != nil:
+			verifyErr = err
+		case entry.PrevHash != prevHash:
+			verifyErr = errors.Errorf("entry %d: chain broken, previous hash %s expected", entry.Seq, prevHash)
+		case entry.Hash != hash:
+			verifyErr = errors.Errorf("entry %d: invalid hash", entry.Seq)
+		}
+		if verifyErr != nil {
+			return false
+		}
+		prevHash = entry.Hash
+		count++
+		return true
+	}); err != nil {
+		return count, errors.Wrapf(err, "cannot verify audit log %s", a.path)
+	}
+	return count, verifyErr
+}
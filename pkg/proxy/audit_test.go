@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+func TestAuditLogChain(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	evt := &event.Event{Type: event.TypePlay, Source: "core01", Target: "display01", Operator: "operator01"}
+	for _, syncInterval := range []time.Duration{0, time.Hour} {
+		auditLog, err := NewAuditLog(path, syncInterval, logger)
+		if err != nil {
+			t.Fatalf("cannot open audit log: %v", err)
+		}
+		for _, outcome := range []AuditOutcome{AuditDelivered, AuditQueued} {
+			if err := auditLog.Log("core01", "display01", evt, outcome, nil); err != nil {
+				t.Fatalf("cannot write audit entry: %v", err)
+			}
+		}
+		// close syncs the batched entries
+		if err := auditLog.Close(); err != nil {
+			t.Fatalf("cannot close audit log: %v", err)
+		}
+	}
+
+	auditLog, err := NewAuditLog(path, 0, logger)
+	if err != nil {
+		t.Fatalf("cannot reopen audit log: %v", err)
+	}
+	defer auditLog.Close()
+	count, err := auditLog.Verify()
+	if err != nil || count != 4 {
+		t.Fatalf("expected 4 valid entries, got %d: %v", count, err)
+	}
+	entries, err := auditLog.Query(&AuditFilter{Operator: "operator01", Limit: 1})
+	if err != nil {
+		t.Fatalf("cannot query audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 4 || entries[0].Outcome != AuditQueued {
+		t.Fatalf("expected the last entry, got %+v", entries)
+	}
+}
+
+// TestAuditLogSyncError chains the next entry to an entry, which is written, but not synced
+func TestAuditLogSyncError(t *testing.T) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	auditLog, err := NewAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 0, logger)
+	if err != nil {
+		t.Fatalf("cannot open audit log: %v", err)
+	}
+	// writes to a pipe succeed, its sync fails
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("cannot create pipe: %v", err)
+	}
+	defer r.Close()
+	file := auditLog.fp
+	auditLog.fp = w
+	defer func() {
+		w.Close()
+		auditLog.fp = file
+		auditLog.dirty = false
+		auditLog.Close()
+	}()
+
+	evt := &event.Event{Type: event.TypePlay, Source: "core01", Target: "display01"}
+	lines := bufio.NewScanner(r)
+	var prev = &AuditEntry{}
+	for i := 0; i < 2; i++ {
+		if err := auditLog.Log("core01", "display01", evt, AuditDelivered, nil); !errors.Is(err, ErrAuditNotSynced) {
+			t.Fatalf("expected ErrAuditNotSynced, got %v", err)
+		}
+		if !lines.Scan() {
+			t.Fatalf("cannot read entry: %v", lines.Err())
+		}
+		var entry = &AuditEntry{}
+		if err := json.Unmarshal(lines.Bytes(), entry); err != nil {
+			t.Fatalf("cannot decode entry: %v", err)
+		}
+		if entry.Seq != prev.Seq+1 || entry.PrevHash != prev.Hash {
+			t.Fatalf("entry %d not chained to %d: %+v", entry.Seq, prev.Seq, entry)
+		}
+		prev = entry
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	srv := newTestServer(t)
+	if srv.isAdmin([]string{"ws:core01"}) {
+		t.Fatal("empty admin list allows access")
+	}
+	srv.SetAdmins([]string{"ws:admin"})
+	if srv.isAdmin([]string{"ws:core01"}) || srv.isAdmin(nil) {
+		t.Fatal("client without admin name allowed")
+	}
+	if !srv.isAdmin([]string{"ws:core01", "ws:admin"}) {
+		t.Fatal("admin denied")
+	}
+}
@@ -2,26 +2,26 @@ package proxy
 
 import (
 	"emperror.dev/errors"
-	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/pkg/transport"
 )
 
-func newConnection(conn *websocket.Conn, name string, secure bool) *connection {
+func newConnection(t transport.Transport, name string, secure bool) *connection {
 	return &connection{
-		Secure: secure,
-		Conn:   conn,
-		Name:   name,
+		Secure:    secure,
+		Transport: t,
+		Name:      name,
 	}
 }
 
 type connection struct {
-	Secure bool
-	Conn   *websocket.Conn
-	Name   string
+	Secure    bool
+	Transport transport.Transport
+	Name      string
 }
 
 func (c *connection) Close() error {
-	if c.Conn != nil {
-		return errors.WithStack(c.Conn.Close())
+	if c.Transport != nil {
+		return errors.WithStack(c.Transport.Close())
 	}
 	return nil
 }
@@ -1,8 +1,11 @@
 package proxy
 
 import (
+	"encoding/json"
+	"maps"
 	"slices"
 	"sync"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/je4/securedisplay/pkg/event"
@@ -15,7 +18,11 @@ func newConnectionManager(debug bool, logger zLogger.ZLogger) *connectionManager
 		wsConns:       make(map[string]*connection),
 		wsConnsMu:     sync.Mutex{},
 		groups:        make(map[string][]string),
+		attached:      make(map[string][]string),
 		groupsMu:      sync.RWMutex{},
+		known:         make(map[string]struct{}),
+		statuses:      make(map[string]json.RawMessage),
+		healths:       make(map[string]*event.Health),
 		logger:        logger,
 		senderChannel: make(chan *job, 100),
 		workerWG:      sync.WaitGroup{},
@@ -26,6 +33,8 @@ func newConnectionManager(debug bool, logger zLogger.ZLogger) *connectionManager
 type job struct {
 	evt  *event.Event
 	dest string
+	// origin is the authenticated name of the sending connection, empty for events of the proxy
+	origin string
 }
 
 type connectionManager struct {
@@ -33,44 +42,218 @@ type connectionManager struct {
 	wsConnsMu     sync.Mutex
 	groups        map[string][]string
 	groupsMu      sync.RWMutex
+	statuses      map[string]json.RawMessage
+	statusesMu    sync.RWMutex
+	healths       map[string]*event.Health
+	healthsMu     sync.RWMutex
+	store         *Store
+	queueSize     int
+	queueTotal    int
+	queueMaxAge   time.Duration
+	auditLog      *AuditLog
+	emergency     *event.Event
+	emergencyMu   sync.Mutex
 	debug         bool
 	logger        zLogger.ZLogger
 	senderChannel chan *job
+	senderMu      sync.RWMutex
+	closed        bool
 	workerWG      sync.WaitGroup
+	// workerQuit stops the running workers, one channel per worker
+	workerQuit []chan struct{}
+	workersMu  sync.Mutex
+	// attached are the group members, which joined with attach events. Only they are persisted. Guarded by groupsMu.
+	attached map[string][]string
+	// known are the clients, which connected, are group members or were provisioned. Events are queued for them only.
+	known   map[string]struct{}
+	knownMu sync.RWMutex
+	// playbackMaxAge is the maximum age of queued playback commands, older ones are not replayed
+	playbackMaxAge time.Duration
 }
 
-func (manager *connectionManager) start(numWorkers int) {
-	for i := 0; i < numWorkers; i++ {
-		manager.logger.Debug().Msgf("Starting worker #%d", i)
-		go manager.worker(i, manager.senderChannel)
+// errNoConnection is returned if an event cannot be delivered, because the destination is not connected
+var errNoConnection = errors.New("no connection")
+
+// volatileTypes are not queued for offline destinations
+var volatileTypes = []event.EventType{
+	event.TypeNTPQuery,
+	event.TypeNTPResponse,
+	event.TypeNTPError,
+	event.TypeStatus,
+	event.TypeHealth,
+	event.TypeLog,
+	event.TypeConnected,
+	event.TypeDisconnected,
+}
+
+// playbackTypes are queued for a short time only, a display should not start an old playback after a reconnect
+var playbackTypes = []event.EventType{
+	event.TypeLoad,
+	event.TypePlay,
+	event.TypePause,
+	event.TypeStop,
+	event.TypeUnload,
+	event.TypeSetVolume,
+	event.TypeMute,
+	event.TypeUnmute,
+	event.TypeFadeIn,
+	event.TypeFadeOut,
+	event.TypeBrowserNavigate,
+	event.TypeBrowserPreload,
+	event.TypePrefetch,
+}
+
+// setStore loads groups and states from the store and persists all further changes
+func (manager *connectionManager) setStore(store *Store, queueSize int, queueTotal int, queueMaxAge time.Duration, playbackMaxAge time.Duration) error {
+	groups, err := store.Groups()
+	if err != nil {
+		return errors.Wrap(err, "cannot load groups")
+	}
+	statuses, err := store.Statuses()
+	if err != nil {
+		return errors.Wrap(err, "cannot load statuses")
+	}
+	emergency, err := store.Emergency()
+	if err != nil {
+		return errors.Wrap(err, "cannot load emergency")
+	}
+	issued, err := store.Issued()
+	if err != nil {
+		return errors.Wrap(err, "cannot load provisioned displays")
+	}
+	manager.groupsMu.Lock()
+	for group, members := range groups {
+		for _, name := range members {
+			if !slices.Contains(manager.groups[group], name) {
+				manager.groups[group] = append(manager.groups[group], name)
+			}
+			if !slices.Contains(manager.attached[group], name) {
+				manager.attached[group] = append(manager.attached[group], name)
+			}
+			manager.addKnown(name)
+		}
+	}
+	manager.groupsMu.Unlock()
+	manager.statusesMu.Lock()
+	maps.Copy(manager.statuses, statuses)
+	manager.statusesMu.Unlock()
+	for name := range statuses {
+		manager.addKnown(name)
+	}
+	for _, name := range issued {
+		manager.addKnown(name)
+	}
+	if emergency != nil {
+		manager.emergencyMu.Lock()
+		manager.emergency = emergency
+		manager.emergencyMu.Unlock()
+		manager.logger.Warn().Msgf("emergency from %s still in force", emergency.GetSource())
+	}
+	manager.store = store
+	manager.queueSize = queueSize
+	manager.queueTotal = queueTotal
+	manager.queueMaxAge = queueMaxAge
+	manager.playbackMaxAge = playbackMaxAge
+	manager.logger.Info().Msgf("loaded %d groups and %d statuses from store", len(groups), len(statuses))
+	return nil
+}
+
+// setWorkers starts or stops workers until numWorkers are running
+func (manager *connectionManager) setWorkers(numWorkers int) {
+	manager.workersMu.Lock()
+	defer manager.workersMu.Unlock()
+	for len(manager.workerQuit) < numWorkers {
+		id := len(manager.workerQuit)
+		quit := make(chan struct{})
+		manager.workerQuit = append(manager.workerQuit, quit)
+		manager.logger.Debug().Msgf("Starting worker #%d", id)
+		manager.workerWG.Add(1)
+		go manager.worker(id, manager.senderChannel, quit)
+	}
+	for len(manager.workerQuit) > numWorkers && len(manager.workerQuit) > 1 {
+		last := len(manager.workerQuit) - 1
+		manager.logger.Debug().Msgf("Stopping worker #%d", last)
+		close(manager.workerQuit[last])
+		manager.workerQuit = manager.workerQuit[:last]
 	}
 }
 
 func (manager *connectionManager) close() {
+	manager.senderMu.Lock()
+	manager.closed = true
 	close(manager.senderChannel)
+	manager.senderMu.Unlock()
 	manager.workerWG.Wait()
 }
-func (manager *connectionManager) worker(id int, jobs <-chan *job) {
-	manager.workerWG.Add(1)
+func (manager *connectionManager) worker(id int, jobs <-chan *job, quit <-chan struct{}) {
 	defer manager.workerWG.Done()
-	for j := range jobs {
+	for {
+		var j *job
+		var ok bool
+		select {
+		case <-quit:
+			return
+		case j, ok = <-jobs:
+			if !ok {
+				return
+			}
+		}
 		manager.logger.Debug().Msgf("worker #%d forwarding event %s %s -> %s to %s", id, j.evt.Type, j.evt.GetSource(), j.evt.GetTarget(), j.dest)
 		if err := manager.sendWS(j.dest, j.evt); err != nil {
+			if errors.Is(err, errNoConnection) && manager.enqueue(j.dest, j.evt) {
+				manager.logger.Debug().Msgf("worker #%d queued event %s for %s", id, j.evt.Type, j.dest)
+				manager.audit(j, AuditQueued, nil)
+				continue
+			}
 			manager.logger.Error().Err(err).Msgf("worker #%d failed to send event", id)
+			manager.audit(j, AuditFailed, err)
 			continue
 		}
+		manager.audit(j, AuditDelivered, nil)
 		manager.logger.Debug().Msgf("worker #%d event %s %s -> %s to %s forwarded", id, j.evt.Type, j.evt.GetSource(), j.evt.GetTarget(), j.dest)
 	}
 }
 
+// audit writes the outcome of a job of a client to the audit log
+func (manager *connectionManager) audit(j *job, outcome AuditOutcome, err error) {
+	if manager.auditLog == nil || j.origin == "" || slices.Contains(volatileTypes, j.evt.GetType()) {
+		return
+	}
+	if err := manager.auditLog.Log(j.origin, j.dest, j.evt, outcome, err); err != nil {
+		if errors.Is(err, ErrAuditNotSynced) {
+			manager.logger.Error().Err(err).Msgf("audit entry for %s from %s written, but not synced", j.evt.GetType(), j.origin)
+			return
+		}
+		manager.logger.Error().Err(err).Msgf("cannot write audit entry for %s from %s", j.evt.GetType(), j.origin)
+	}
+}
+
+// reject writes a rejected event of a client to the audit log
+func (manager *connectionManager) reject(origin string, evt *event.Event, err error) {
+	manager.audit(&job{evt: evt, origin: origin}, AuditRejected, err)
+}
+
 func (manager *connectionManager) send(evt *event.Event) error {
+	return manager.forward("", evt)
+}
+
+// forward sends an event of the client origin to its target
+func (manager *connectionManager) forward(origin string, evt *event.Event) error {
+	manager.senderMu.RLock()
+	defer manager.senderMu.RUnlock()
+	if manager.closed {
+		return errors.Errorf("connection manager closed, cannot send event %s", evt)
+	}
+	manager.groupsMu.RLock()
 	dests, ok := manager.groups[evt.GetTarget()]
+	dests = slices.Clone(dests)
+	manager.groupsMu.RUnlock()
 	if !ok {
-		manager.senderChannel <- &job{evt: evt, dest: evt.GetTarget()}
+		manager.senderChannel <- &job{evt: evt, dest: evt.GetTarget(), origin: origin}
 		return nil
 	}
 	for _, dest := range dests {
-		manager.senderChannel <- &job{evt: evt, dest: dest}
+		manager.senderChannel <- &job{evt: evt, dest: dest, origin: origin}
 	}
 	return nil
 }
@@ -78,14 +261,122 @@ func (manager *connectionManager) send(evt *event.Event) error {
 func (manager *connectionManager) sendWS(dest string, evt *event.Event) error {
 	conn, ok := manager.getWSConn(dest)
 	if !ok {
-		return errors.Errorf("no connection for destination %s", dest)
+		return errors.Wrapf(errNoConnection, "no connection for destination %s", dest)
 	}
-	if err := conn.Conn.WriteJSON(evt); err != nil {
+	if err := conn.Transport.WriteEvent(evt); err != nil {
 		return errors.Wrapf(err, "failed to send event %s to %s->%s", evt.GetType(), evt.GetSource(), evt.GetTarget())
 	}
 	return nil
 }
 
+// enqueue stores an event for an offline destination and returns true, if the event has been queued
+func (manager *connectionManager) enqueue(dest string, evt *event.Event) bool {
+	if manager.store == nil || slices.Contains(volatileTypes, evt.GetType()) {
+		return false
+	}
+	if !manager.isKnown(dest) {
+		manager.logger.Warn().Msgf("event %s for unknown destination %s not queued", evt.GetType(), dest)
+		return false
+	}
+	if err := manager.store.Enqueue(dest, evt, manager.queueSize, manager.queueTotal); err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot queue event %s for %s", evt.GetType(), dest)
+		return false
+	}
+	return true
+}
+
+// flushQueue sends all queued events of a destination
+func (manager *connectionManager) flushQueue(dest string) {
+	if manager.store == nil {
+		return
+	}
+	events, err := manager.store.Dequeue(dest, manager.queueMaxAge)
+	if err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot load queued events for %s", dest)
+		return
+	}
+	manager.senderMu.RLock()
+	defer manager.senderMu.RUnlock()
+	if manager.closed {
+		return
+	}
+	for _, qe := range events {
+		evt := qe.Event
+		if manager.playbackMaxAge > 0 && slices.Contains(playbackTypes, evt.GetType()) && time.Since(qe.Time) > manager.playbackMaxAge {
+			manager.logger.Debug().Msgf("dropping queued playback command %s for %s from %s", evt.GetType(), dest, qe.Time)
+			continue
+		}
+		manager.logger.Debug().Msgf("sending queued event %s to %s", evt.GetType(), dest)
+		manager.senderChannel <- &job{evt: evt, dest: dest}
+	}
+}
+
+// setStatus remembers the last status of a display
+func (manager *connectionManager) setStatus(name string, status json.RawMessage) {
+	manager.statusesMu.Lock()
+	manager.statuses[name] = status
+	manager.statusesMu.Unlock()
+	if manager.store != nil {
+		if err := manager.store.SaveStatus(name, status); err != nil {
+			manager.logger.Error().Err(err).Msgf("cannot store status of %s", name)
+		}
+	}
+}
+
+// Statuses returns a copy of the last known status of all displays
+func (manager *connectionManager) Statuses() map[string]json.RawMessage {
+	manager.statusesMu.RLock()
+	defer manager.statusesMu.RUnlock()
+	return maps.Clone(manager.statuses)
+}
+
+// setHealth remembers the last health report of a display
+func (manager *connectionManager) setHealth(name string, data json.RawMessage) {
+	var health = &event.Health{}
+	if err := json.Unmarshal(data, health); err != nil {
+		manager.logger.Error().Err(err).Msgf("invalid health event from %s", name)
+		return
+	}
+	manager.healthsMu.Lock()
+	manager.healths[name] = health
+	manager.healthsMu.Unlock()
+}
+
+// Healths returns a copy of the last health report of all displays
+func (manager *connectionManager) Healths() map[string]*event.Health {
+	manager.healthsMu.RLock()
+	defer manager.healthsMu.RUnlock()
+	return maps.Clone(manager.healths)
+}
+
+// numConnections returns the number of open websocket connections
+func (manager *connectionManager) numConnections() int {
+	manager.wsConnsMu.Lock()
+	defer manager.wsConnsMu.Unlock()
+	return len(manager.wsConns)
+}
+
+// Groups returns a copy of all groups and their members
+func (manager *connectionManager) Groups() map[string][]string {
+	manager.groupsMu.RLock()
+	defer manager.groupsMu.RUnlock()
+	var groups = make(map[string][]string, len(manager.groups))
+	for group, members := range manager.groups {
+		groups[group] = slices.Clone(members)
+	}
+	return groups
+}
+
+// saveGroup persists the attached members of a group. groupsMu must be held by the caller.
+func (manager *connectionManager) saveGroup(group string) {
+	if manager.store == nil {
+		return
+	}
+	if err := manager.store.SaveGroup(group, manager.attached[group]); err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot store group %s", group)
+	}
+}
+
 func (manager *connectionManager) addWSConn(c *connection) error {
 	name := c.Name
 	if conn, ok := manager.getWSConn(name); ok {
@@ -100,9 +391,35 @@ func (manager *connectionManager) addWSConn(c *connection) error {
 	defer manager.wsConnsMu.Unlock()
 	manager.logger.Debug().Msgf("Adding connection %s", name)
 	manager.wsConns[name] = c
+	manager.addKnown(name)
 	return nil
 }
 
+// issued remembers the name of a provisioned display
+func (manager *connectionManager) issued(name string) {
+	manager.addKnown(name)
+	if manager.store == nil {
+		return
+	}
+	if err := manager.store.SaveIssued(name, time.Now()); err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot store provisioned display %s", name)
+	}
+}
+
+// addKnown allows queued events for a client
+func (manager *connectionManager) addKnown(name string) {
+	manager.knownMu.Lock()
+	defer manager.knownMu.Unlock()
+	manager.known[name] = struct{}{}
+}
+
+func (manager *connectionManager) isKnown(name string) bool {
+	manager.knownMu.RLock()
+	defer manager.knownMu.RUnlock()
+	_, ok := manager.known[name]
+	return ok
+}
+
 func (manager *connectionManager) getWSConn(name string) (*connection, bool) {
 	manager.wsConnsMu.Lock()
 	defer manager.wsConnsMu.Unlock()
@@ -118,50 +435,104 @@ func (manager *connectionManager) removeWSConn(name string) {
 	delete(manager.wsConns, name)
 }
 
-func (manager *connectionManager) closeWSConn(wsConn *connection) {
+// closeWSConn closes the connection and returns true, if it was the active connection of its name
+func (manager *connectionManager) closeWSConn(wsConn *connection) bool {
 	manager.wsConnsMu.Lock()
 	defer manager.wsConnsMu.Unlock()
 	if conn, ok := manager.wsConns[wsConn.Name]; ok {
-		if conn.Conn.RemoteAddr() != wsConn.Conn.RemoteAddr() {
-			manager.logger.Debug().Msgf("connection %s[%s] already closed.", wsConn.Name, wsConn.Conn.RemoteAddr())
-			return
+		if conn != wsConn {
+			manager.logger.Debug().Msgf("connection %s[%s] already closed.", wsConn.Name, wsConn.Transport.RemoteAddr())
+			return false
 		}
-		manager.logger.Debug().Msgf("Closing connection %s[%s]", wsConn.Name, wsConn.Conn.RemoteAddr())
+		manager.logger.Debug().Msgf("Closing connection %s[%s]", wsConn.Name, wsConn.Transport.RemoteAddr())
 		if err := conn.Close(); err != nil {
 			manager.logger.Error().Err(err).Msg("Failed to close connection")
 		}
 		delete(manager.wsConns, wsConn.Name)
+		return true
 	}
+	return false
 }
 
+// presence informs the core group about connecting and disconnecting clients
+func (manager *connectionManager) presence(t event.EventType, name string) {
+	jsonBytes, err := json.Marshal(name)
+	if err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot marshal name %s", name)
+		return
+	}
+	if err := manager.send(&event.Event{
+		Type:   t,
+		Source: "",
+		Target: "core",
+		Token:  "",
+		Data:   jsonBytes,
+	}); err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot send %s event for %s", t, name)
+	}
+}
+
+// AddToGroup adds a member to a group until the restart of the proxy
 func (manager *connectionManager) AddToGroup(name string, group string) {
 	manager.groupsMu.Lock()
 	defer manager.groupsMu.Unlock()
+	manager.addToGroup(name, group)
+}
+
+// addToGroup adds a member to a group. groupsMu must be held by the caller.
+func (manager *connectionManager) addToGroup(name string, group string) {
 	if _, ok := manager.groups[group]; !ok {
 		manager.groups[group] = []string{}
 	}
 	if !slices.Contains(manager.groups[group], name) {
 		manager.groups[group] = append(manager.groups[group], name)
 	}
+	manager.addKnown(name)
+}
+
+// attach adds a member to a group and persists the membership
+func (manager *connectionManager) attach(name string, group string) {
+	manager.groupsMu.Lock()
+	defer manager.groupsMu.Unlock()
+	manager.addToGroup(name, group)
+	if !slices.Contains(manager.attached[group], name) {
+		manager.attached[group] = append(manager.attached[group], name)
+		manager.saveGroup(group)
+	}
 }
 
 func (manager *connectionManager) RemoveFromGroup(name string, group string) {
 	manager.groupsMu.Lock()
 	defer manager.groupsMu.Unlock()
-	if _, ok := manager.groups[group]; !ok {
+	manager.removeFromGroup(name, group)
+}
+
+// removeFromGroup removes a member from a group. groupsMu must be held by the caller.
+func (manager *connectionManager) removeFromGroup(name string, group string) {
+	isMember := func(s string) bool { return s == name }
+	if slices.Contains(manager.groups[group], name) {
+		manager.groups[group] = slices.DeleteFunc(manager.groups[group], isMember)
+	}
+	if slices.Contains(manager.attached[group], name) {
+		manager.attached[group] = slices.DeleteFunc(manager.attached[group], isMember)
+		manager.saveGroup(group)
+	}
+}
+
+// removeStatic removes a member, which is not persisted by an attach event
+func (manager *connectionManager) removeStatic(name string, group string) {
+	manager.groupsMu.Lock()
+	defer manager.groupsMu.Unlock()
+	if slices.Contains(manager.attached[group], name) {
 		return
 	}
-	slices.DeleteFunc(manager.groups[group], func(s string) bool {
-		return s == name
-	})
+	manager.groups[group] = slices.DeleteFunc(manager.groups[group], func(s string) bool { return s == name })
 }
 
 func (manager *connectionManager) RemoveFromGroups(name string) {
 	manager.groupsMu.Lock()
 	defer manager.groupsMu.Unlock()
-	for group, _ := range manager.groups {
-		slices.DeleteFunc(manager.groups[group], func(s string) bool {
-			return s == name
-		})
+	for group := range manager.groups {
+		manager.removeFromGroup(name, group)
 	}
 }
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"maps"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// setEmergency activates or clears the emergency and sends the event to every connection except origin
+func (manager *connectionManager) setEmergency(origin string, evt *event.Event) error {
+	var active *event.Event
+	switch evt.GetType() {
+	case event.TypeEmergency:
+		var emergency = &event.Emergency{}
+		if err := evt.GetPageData(emergency); err != nil {
+			return errors.Wrap(err, "invalid emergency")
+		}
+		if emergency.ID == "" {
+			return errors.New("emergency without id")
+		}
+		manager.emergencyMu.Lock()
+		manager.emergency = evt
+		manager.emergencyMu.Unlock()
+		active = evt
+	case event.TypeEmergencyClear:
+		var id string
+		if err := evt.GetPageData(&id); err != nil {
+			return errors.Wrap(err, "invalid emergency id")
+		}
+		if err := manager.clearEmergency(id); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("no emergency event: %s", evt.GetType())
+	}
+	if manager.store != nil {
+		if err := manager.store.SaveEmergency(active); err != nil {
+			manager.logger.Error().Err(err).Msg("cannot store emergency")
+		}
+	}
+	manager.broadcast(origin, evt)
+	return nil
+}
+
+// clearEmergency removes the active emergency, if it has the given id. An empty id matches every emergency.
+func (manager *connectionManager) clearEmergency(id string) error {
+	manager.emergencyMu.Lock()
+	defer manager.emergencyMu.Unlock()
+	if manager.emergency == nil {
+		return errors.New("no active emergency")
+	}
+	var active = &event.Emergency{}
+	_ = manager.emergency.GetPageData(active)
+	if id != "" && id != active.ID {
+		return errors.Errorf("emergency %s not active", id)
+	}
+	manager.emergency = nil
+	return nil
+}
+
+// broadcast sends the event directly to all connections except origin, bypassing the worker queue
+func (manager *connectionManager) broadcast(origin string, evt *event.Event) {
+	manager.wsConnsMu.Lock()
+	dests := slices.Collect(maps.Keys(manager.wsConns))
+	manager.wsConnsMu.Unlock()
+	for _, dest := range dests {
+		if dest == origin {
+			continue
+		}
+		go func() {
+			j := &job{evt: evt, dest: dest, origin: origin}
+			if err := manager.sendWS(dest, evt); err != nil {
+				manager.logger.Error().Err(err).Msgf("cannot send %s to %s", evt.GetType(), dest)
+				manager.audit(j, AuditFailed, err)
+				return
+			}
+			manager.audit(j, AuditDelivered, nil)
+		}()
+	}
+}
+
+// sendEmergency sends the active emergency to a new connection
+func (manager *connectionManager) sendEmergency(dest string) {
+	manager.emergencyMu.Lock()
+	evt := manager.emergency
+	manager.emergencyMu.Unlock()
+	if evt == nil {
+		return
+	}
+	manager.logger.Info().Msgf("sending active emergency to %s", dest)
+	if err := manager.sendWS(dest, evt); err != nil {
+		manager.logger.Error().Err(err).Msgf("cannot send emergency to %s", dest)
+	}
+}
+
+// Emergency returns the active emergency or nil
+func (manager *connectionManager) Emergency() *event.Emergency {
+	manager.emergencyMu.Lock()
+	defer manager.emergencyMu.Unlock()
+	if manager.emergency == nil {
+		return nil
+	}
+	var emergency = &event.Emergency{}
+	if err := manager.emergency.GetPageData(emergency); err != nil {
+		return nil
+	}
+	return emergency
+}
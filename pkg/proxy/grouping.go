@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// GroupRule assigns groups to all clients with a name matching Pattern (path.Match syntax)
+type GroupRule struct {
+	Pattern string   `toml:"pattern"`
+	Groups  []string `toml:"groups"`
+}
+
+// Grouping defines how groups are assigned when a connection is accepted
+type Grouping struct {
+	// URIScheme takes the groups from certificate SAN URIs like group:hall-a, empty disables
+	URIScheme string `toml:"uri_scheme"`
+	// OU takes the groups from the organizational units of the certificate subject
+	OU bool `toml:"ou"`
+	// OUPrefix restricts the organizational units to the ones with this prefix, which is removed
+	OUPrefix string `toml:"ou_prefix"`
+	// AllowAttach allows clients to join groups which are not assigned to them. It is an opt-in,
+	// which defeats the assignment by certificate.
+	AllowAttach bool         `toml:"allow_attach"`
+	Rules       []*GroupRule `toml:"rule"`
+}
+
+// Validate checks the patterns of the rules
+func (g *Grouping) Validate() error {
+	if g == nil {
+		return nil
+	}
+	for _, rule := range g.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid group rule pattern %s", rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// Groups returns the groups of a client with the given name and certificate attributes
+func (g *Grouping) Groups(name string, uris []*url.URL, ous []string) []string {
+	var groups = []string{}
+	if g == nil {
+		return groups
+	}
+	add := func(group string) {
+		if group != "" && !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	for _, rule := range g.Rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			for _, group := range rule.Groups {
+				add(group)
+			}
+		}
+	}
+	if g.URIScheme != "" {
+		for _, u := range uris {
+			if u == nil || !strings.EqualFold(u.Scheme, g.URIScheme) {
+				continue
+			}
+			group := u.Opaque
+			if group == "" {
+				group = strings.TrimPrefix(u.Host+u.Path, "/")
+			}
+			add(group)
+		}
+	}
+	if g.OU {
+		for _, ou := range ous {
+			if group, ok := strings.CutPrefix(ou, g.OUPrefix); ok {
+				add(group)
+			}
+		}
+	}
+	return groups
+}
+
+// CanAttach checks whether a client with the assigned groups may join group
+func (g *Grouping) CanAttach(group string, assigned []string) bool {
+	if g == nil || g.AllowAttach {
+		return true
+	}
+	return slices.Contains(assigned, group)
+}
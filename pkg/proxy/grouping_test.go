@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/je4/securedisplay/config"
+)
+
+// TestDefaultGrouping checks that the default configuration assigns core to all clients and
+// allows no attach to other groups
+func TestDefaultGrouping(t *testing.T) {
+	var conf = struct {
+		Grouping Grouping `toml:"grouping"`
+	}{}
+	if _, err := toml.Decode(string(config.ProxyToml), &conf); err != nil {
+		t.Fatalf("cannot decode default config: %v", err)
+	}
+	if err := conf.Grouping.Validate(); err != nil {
+		t.Fatalf("invalid default grouping: %v", err)
+	}
+	groups := conf.Grouping.Groups("display01", nil, nil)
+	if !slices.Contains(groups, "core") {
+		t.Fatalf("expected core in %v", groups)
+	}
+	if !conf.Grouping.CanAttach("core", groups) {
+		t.Fatal("display01 cannot attach to core")
+	}
+	if conf.Grouping.CanAttach("hall-a", groups) {
+		t.Fatal("display01 can attach to the unassigned group hall-a")
+	}
+}
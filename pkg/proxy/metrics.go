@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+const metricsPrefix = "securedisplay_"
+
+// displayGauges are the values of the health reports exported per display
+var displayGauges = []struct {
+	name  string
+	help  string
+	value func(h *event.Health) float64
+}{
+	{"display_health_timestamp_seconds", "time of the last health report", func(h *event.Health) float64 { return float64(h.Time.Unix()) }},
+	{"display_load1", "load average over 1 minute", func(h *event.Health) float64 { return h.Load1 }},
+	{"display_load5", "load average over 5 minutes", func(h *event.Health) float64 { return h.Load5 }},
+	{"display_load15", "load average over 15 minutes", func(h *event.Health) float64 { return h.Load15 }},
+	{"display_memory_total_bytes", "total memory", func(h *event.Health) float64 { return float64(h.MemTotal) }},
+	{"display_memory_available_bytes", "available memory", func(h *event.Health) float64 { return float64(h.MemAvailable) }},
+	{"display_disk_total_bytes", "size of the filesystem", func(h *event.Health) float64 { return float64(h.DiskTotal) }},
+	{"display_disk_free_bytes", "free space of the filesystem", func(h *event.Health) float64 { return float64(h.DiskFree) }},
+	{"display_cpu_temperature_celsius", "highest temperature of the thermal zones", func(h *event.Health) float64 { return h.CPUTemperature }},
+	{"display_uptime_seconds", "uptime of the display process", func(h *event.Health) float64 { return h.Uptime }},
+	{"display_system_uptime_seconds", "uptime of the display system", func(h *event.Health) float64 { return h.SystemUptime }},
+}
+
+// label escapes a prometheus label value
+func label(value string) string {
+	return strconv.Quote(value)
+}
+
+func writeHeader(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s gauge\n", metricsPrefix, name, help, metricsPrefix, name)
+}
+
+// metrics exports the connections and the health of the displays in the prometheus text format
+func (srv *SocketServer) metrics(c *gin.Context) {
+	healths := srv.connectionManager.Healths()
+	var names = []string{}
+	for name := range healths {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var sb = &strings.Builder{}
+	writeHeader(sb, "connections", "open websocket connections")
+	fmt.Fprintf(sb, "%sconnections %d\n", metricsPrefix, srv.connectionManager.numConnections())
+	for _, gauge := range displayGauges {
+		writeHeader(sb, gauge.name, gauge.help)
+		for _, name := range names {
+			fmt.Fprintf(sb, "%s%s{display=%s} %g\n", metricsPrefix, gauge.name, label(name), gauge.value(healths[name]))
+		}
+	}
+	writeHeader(sb, "display_interface_up", "state of the network interfaces")
+	for _, name := range names {
+		for _, iface := range healths[name].Interfaces {
+			var up int
+			if iface.Up {
+				up = 1
+			}
+			fmt.Fprintf(sb, "%sdisplay_interface_up{display=%s,interface=%s,mac=%s} %d\n", metricsPrefix, label(name), label(iface.Name), label(iface.MAC), up)
+		}
+	}
+	writeHeader(sb, "display_browser_metric", "chrome performance metrics of the page")
+	for _, name := range names {
+		metrics := healths[name].Browser
+		var keys = []string{}
+		for key := range metrics {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(sb, "%sdisplay_browser_metric{display=%s,metric=%s} %g\n", metricsPrefix, label(name), label(key), metrics[key])
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(sb.String()))
+}
@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/je4/securedisplay/pkg/provision"
+)
+
+// maxPendingProvisions limits the open requests of unknown displays
+const maxPendingProvisions = 100
+
+var displayNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Provisioning issues the certificates of new displays, which are approved by an operator
+type Provisioning struct {
+	CA *provision.CA
+	// BootstrapNames are the certificate dns names of the bootstrap credentials
+	BootstrapNames []string
+	// Validity of the issued certificates
+	Validity time.Duration
+	// MaxAge of unanswered requests
+	MaxAge time.Duration
+	// DisplayConfig is the toml configuration sent to the approved displays
+	DisplayConfig string
+	// Admins are the certificate names allowed to approve displays, an empty list denies all clients
+	Admins []string
+	// ReservedNames cannot be given to displays
+	ReservedNames []string
+}
+
+type provisionRequest struct {
+	ID string `json:"id"`
+	// Code is not shown to the operator, who reads it from the display
+	Code      string           `json:"-"`
+	Hostname  string           `json:"hostname"`
+	Remote    string           `json:"remote"`
+	Bootstrap string           `json:"bootstrap"`
+	Created   time.Time        `json:"created"`
+	Status    provision.Status `json:"status"`
+	Name      string           `json:"name,omitempty"`
+	Groups    []string         `json:"groups,omitempty"`
+	csr       string
+	result    *provision.Result
+}
+
+type provisioner struct {
+	sync.Mutex
+	requests map[string]*provisionRequest
+}
+
+// expire removes old requests. The provisioner must be locked by the caller.
+func (p *provisioner) expire(maxAge time.Duration) {
+	for id, req := range p.requests {
+		if time.Since(req.Created) > maxAge {
+			delete(p.requests, id)
+		}
+	}
+}
+
+// SetProvisioning enables the provisioning of new displays, nil disables it
+func (srv *SocketServer) SetProvisioning(provisioning *Provisioning) {
+	srv.settingsMu.Lock()
+	defer srv.settingsMu.Unlock()
+	srv.provisioning = provisioning
+}
+
+func (srv *SocketServer) getProvisioning() *Provisioning {
+	srv.settingsMu.RLock()
+	defer srv.settingsMu.RUnlock()
+	return srv.provisioning
+}
+
+// provisioningEnabled aborts requests while provisioning is disabled.
+// The handlers use the settings stored in the context.
+func (srv *SocketServer) provisioningEnabled(c *gin.Context) {
+	provisioning := srv.getProvisioning()
+	if provisioning == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "provisioning disabled"})
+		return
+	}
+	c.Set("provisioning", provisioning)
+	c.Next()
+}
+
+// provisionAdminOnly aborts requests of clients without a provisioning admin certificate
+func (srv *SocketServer) provisionAdminOnly(c *gin.Context) {
+	provisioning := c.MustGet("provisioning").(*Provisioning)
+	var names = []string{}
+	if namesAny, ok := c.Get("names"); ok {
+		names = namesAny.([]string)
+	}
+	if slices.ContainsFunc(names, func(name string) bool { return slices.Contains(provisioning.Admins, name) }) {
+		c.Next()
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "provisioning admin certificate required"})
+}
+
+// nameTaken returns the reason, why a display cannot get name. The provisioner must be locked by the caller.
+func (srv *SocketServer) nameTaken(name string, provisioning *Provisioning) (string, bool) {
+	if slices.Contains(provisioning.ReservedNames, name) {
+		return "reserved", true
+	}
+	// connected clients, group members and provisioned displays
+	if srv.connectionManager.isKnown(name) {
+		return "in use", true
+	}
+	for _, req := range srv.provisioner.requests {
+		if req.Status == provision.StatusApproved && req.Name == name {
+			return "already approved", true
+		}
+	}
+	return "", false
+}
+
+// bootstrapOnly aborts requests of clients without a bootstrap certificate
+func (srv *SocketServer) bootstrapOnly(c *gin.Context) {
+	provisioning := c.MustGet("provisioning").(*Provisioning)
+	var names = []string{}
+	if namesAny, ok := c.Get("names"); ok {
+		names = namesAny.([]string)
+	}
+	for _, name := range names {
+		if slices.Contains(provisioning.BootstrapNames, name) {
+			c.Set("bootstrap", name)
+			c.Next()
+			return
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "bootstrap certificate required"})
+}
+
+func randomID() (string, error) {
+	var buf = make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "cannot create id")
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func pairingCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create pairing code")
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// provisionCreate registers a display waiting for approval
+func (srv *SocketServer) provisionCreate(c *gin.Context) {
+	var req = &provision.Request{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if req.CSR == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "certificate request missing"})
+		return
+	}
+	id, err := randomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	code, err := pairingCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	srv.provisioner.Lock()
+	defer srv.provisioner.Unlock()
+	srv.provisioner.expire(c.MustGet("provisioning").(*Provisioning).MaxAge)
+	if len(srv.provisioner.requests) >= maxPendingProvisions {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many pending requests"})
+		return
+	}
+	srv.provisioner.requests[id] = &provisionRequest{
+		ID:        id,
+		Code:      code,
+		Hostname:  req.Hostname,
+		Remote:    c.ClientIP(),
+		Bootstrap: c.GetString("bootstrap"),
+		Created:   time.Now(),
+		Status:    provision.StatusPending,
+		csr:       req.CSR,
+	}
+	srv.logger.Info().Msgf("provisioning request %s from %s (%s)", id, req.Hostname, c.ClientIP())
+	c.JSON(http.StatusCreated, &provision.Ticket{ID: id, Code: code})
+}
+
+// provisionResult returns the state of a request. The result of an approved request is returned once.
+func (srv *SocketServer) provisionResult(c *gin.Context) {
+	srv.provisioner.Lock()
+	defer srv.provisioner.Unlock()
+	srv.provisioner.expire(c.MustGet("provisioning").(*Provisioning).MaxAge)
+	req, ok := srv.provisioner.requests[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown or expired request"})
+		return
+	}
+	switch req.Status {
+	case provision.StatusApproved:
+		delete(srv.provisioner.requests, req.ID)
+		c.JSON(http.StatusOK, req.result)
+	case provision.StatusRejected:
+		delete(srv.provisioner.requests, req.ID)
+		c.JSON(http.StatusForbidden, &provision.Result{Status: provision.StatusRejected})
+	default:
+		c.JSON(http.StatusAccepted, &provision.Result{Status: provision.StatusPending})
+	}
+}
+
+// provisionList returns the open requests
+func (srv *SocketServer) provisionList(c *gin.Context) {
+	srv.provisioner.Lock()
+	defer srv.provisioner.Unlock()
+	srv.provisioner.expire(c.MustGet("provisioning").(*Provisioning).MaxAge)
+	var result = []*provisionRequest{}
+	for _, req := range srv.provisioner.requests {
+		result = append(result, req)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Created.Before(result[j].Created) })
+	c.JSON(http.StatusOK, result)
+}
+
+type provisionApproval struct {
+	// Code is the pairing code shown on the display
+	Code   string   `json:"code"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+// provisionApprove issues the certificate for a request with the name and groups of the operator
+func (srv *SocketServer) provisionApprove(c *gin.Context) {
+	var approval = &provisionApproval{}
+	if err := c.ShouldBindJSON(approval); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval: " + err.Error()})
+		return
+	}
+	if !displayNameRegexp.MatchString(approval.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid display name " + approval.Name})
+		return
+	}
+	provisioning := c.MustGet("provisioning").(*Provisioning)
+	srv.provisioner.Lock()
+	defer srv.provisioner.Unlock()
+	req, ok := srv.provisioner.requests[c.Param("id")]
+	if !ok || req.Status != provision.StatusPending {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pending request " + c.Param("id")})
+		return
+	}
+	if req.Code != approval.Code {
+		c.JSON(http.StatusForbidden, gin.H{"error": "wrong pairing code"})
+		return
+	}
+	if reason, taken := srv.nameTaken(approval.Name, provisioning); taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "display name " + approval.Name + " " + reason})
+		return
+	}
+	var uriScheme string
+	if grouping := srv.getGrouping(); grouping != nil {
+		uriScheme = grouping.URIScheme
+	}
+	cert, err := provisioning.CA.Sign(req.csr, approval.Name, approval.Groups, uriScheme, provisioning.Validity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if uriScheme == "" {
+		for _, group := range approval.Groups {
+			srv.connectionManager.attach(approval.Name, group)
+		}
+	}
+	srv.connectionManager.issued(approval.Name)
+	req.Status = provision.StatusApproved
+	req.Name = approval.Name
+	req.Groups = approval.Groups
+	req.result = &provision.Result{
+		Status:      provision.StatusApproved,
+		Name:        approval.Name,
+		Groups:      approval.Groups,
+		Certificate: string(cert),
+		Config:      provisioning.DisplayConfig,
+	}
+	srv.logger.Info().Msgf("provisioning request %s from %s approved as %s %v", req.ID, req.Hostname, approval.Name, approval.Groups)
+	c.JSON(http.StatusOK, req)
+}
+
+func (srv *SocketServer) provisionReject(c *gin.Context) {
+	srv.provisioner.Lock()
+	defer srv.provisioner.Unlock()
+	req, ok := srv.provisioner.requests[c.Param("id")]
+	if !ok || req.Status != provision.StatusPending {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no pending request " + c.Param("id")})
+		return
+	}
+	req.Status = provision.StatusRejected
+	srv.logger.Info().Msgf("provisioning request %s from %s rejected", req.ID, req.Hostname)
+	c.JSON(http.StatusOK, req)
+}
+
+// provisionPage is the admin ui for the approval of new displays
+func (srv *SocketServer) provisionPage(c *gin.Context) {
+	tmpl, err := srv.getTemplate("provision.gohtml")
+	if err != nil {
+		srv.logger.Error().Err(err).Msg("Failed to get template provision.gohtml")
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(c.Writer, nil); err != nil {
+		srv.logger.Error().Err(err).Msg("Failed to execute template")
+	}
+}
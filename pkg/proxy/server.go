@@ -38,6 +38,7 @@ func NewSocketServer(addr string, externalAddr string, numWorkers int, ntpServer
 		numWorkers:        numWorkers,
 		ntpServer:         ntpServer,
 		ntpFunc:           NewNTPConnection(ntpServer, "", "", "", 0, 0),
+		provisioner:       &provisioner{requests: make(map[string]*provisionRequest)},
 		templateFS:        templateFS,
 		staticFS:          staticFS,
 	}
@@ -63,8 +64,18 @@ type SocketServer struct {
 	numWorkers        int
 	ntpServer         string
 	ntpFunc           func(data []byte) ([]byte, error)
+	ntpMu             sync.RWMutex
 	templateFS        fs.FS
 	staticFS          fs.FS
+	workersOnce       sync.Once
+	grouping          *Grouping
+	auditLog          *AuditLog
+	admins            []string
+	emergencySenders  []string
+	provisioning      *Provisioning
+	provisioner       *provisioner
+	// settingsMu protects the settings, which can be changed at runtime
+	settingsMu sync.RWMutex
 }
 
 func (ss *SocketServer) getTemplate(name string) (*template.Template, error) {
@@ -81,7 +92,107 @@ func (ss *SocketServer) getTemplate(name string) (*template.Template, error) {
 	return tmpl, nil
 }
 
-func (srv *SocketServer) Start(tlsConfig *tls.Config) error {
+// startWorkers starts the event forwarding workers once
+func (srv *SocketServer) startWorkers() {
+	srv.workersOnce.Do(func() {
+		srv.connectionManager.setWorkers(srv.numWorkers)
+	})
+}
+
+// SetNumWorkers changes the number of event forwarding workers
+func (srv *SocketServer) SetNumWorkers(numWorkers int) {
+	srv.startWorkers()
+	srv.connectionManager.setWorkers(numWorkers)
+}
+
+// SetNTPServer changes the ntp server for the time queries of the clients
+func (srv *SocketServer) SetNTPServer(ntpServer string) {
+	srv.ntpMu.Lock()
+	defer srv.ntpMu.Unlock()
+	srv.ntpServer = ntpServer
+	srv.ntpFunc = NewNTPConnection(ntpServer, "", "", "", 0, 0)
+}
+
+func (srv *SocketServer) ntp(data []byte) ([]byte, error) {
+	srv.ntpMu.RLock()
+	ntpFunc := srv.ntpFunc
+	srv.ntpMu.RUnlock()
+	return ntpFunc(data)
+}
+
+// SetStore loads the persisted groups and states and enables queuing of events for offline destinations.
+// It must be called before Start.
+func (srv *SocketServer) SetStore(store *Store, queueSize int, queueTotal int, queueMaxAge time.Duration, playbackMaxAge time.Duration) error {
+	return errors.WithStack(srv.connectionManager.setStore(store, queueSize, queueTotal, queueMaxAge, playbackMaxAge))
+}
+
+// SetGrouping sets the rules for the groups assigned to accepted connections.
+// Existing connections keep their groups.
+func (srv *SocketServer) SetGrouping(grouping *Grouping) {
+	srv.settingsMu.Lock()
+	defer srv.settingsMu.Unlock()
+	srv.grouping = grouping
+}
+
+func (srv *SocketServer) getGrouping() *Grouping {
+	srv.settingsMu.RLock()
+	defer srv.settingsMu.RUnlock()
+	return srv.grouping
+}
+
+// SetAuditLog enables the audit log of control events. The log can be queried by clients with one
+// of the admin names, an empty list denies all clients.
+// It must be called before Start.
+func (srv *SocketServer) SetAuditLog(auditLog *AuditLog, admins []string) {
+	srv.auditLog = auditLog
+	srv.SetAdmins(admins)
+	srv.connectionManager.auditLog = auditLog
+}
+
+// SetAdmins changes the client names allowed to use the admin api, an empty list denies all clients
+func (srv *SocketServer) SetAdmins(admins []string) {
+	srv.settingsMu.Lock()
+	defer srv.settingsMu.Unlock()
+	srv.admins = admins
+}
+
+func (srv *SocketServer) isAdmin(names []string) bool {
+	srv.settingsMu.RLock()
+	defer srv.settingsMu.RUnlock()
+	for _, name := range names {
+		if slices.Contains(srv.admins, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEmergencySenders sets the clients allowed to send emergency and emergency-clear events.
+// An empty list denies all clients.
+func (srv *SocketServer) SetEmergencySenders(senders []string) {
+	srv.settingsMu.Lock()
+	defer srv.settingsMu.Unlock()
+	srv.emergencySenders = senders
+}
+
+func (srv *SocketServer) isEmergencySender(name string) bool {
+	srv.settingsMu.RLock()
+	defer srv.settingsMu.RUnlock()
+	return slices.Contains(srv.emergencySenders, name)
+}
+
+// AddToGroup adds a client to a group independent of its attach events. The membership is not persisted.
+func (srv *SocketServer) AddToGroup(name string, group string) {
+	srv.connectionManager.AddToGroup(name, group)
+}
+
+// RemoveFromGroup removes a client added with AddToGroup. A membership by an attach event is kept.
+func (srv *SocketServer) RemoveFromGroup(name string, group string) {
+	srv.connectionManager.removeStatic(name, group)
+}
+
+// handler returns the routes of the pages, the apis and the websocket connections
+func (srv *SocketServer) handler() http.Handler {
 	router := gin.Default()
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
@@ -90,7 +201,6 @@ func (srv *SocketServer) Start(tlsConfig *tls.Config) error {
 		AllowCredentials: true,
 		AllowWebSockets:  true,
 	}))
-	srv.connectionManager.start(srv.numWorkers)
 	router.Use(func(c *gin.Context) {
 		if c.Request.TLS == nil {
 			c.Next()
@@ -113,11 +223,13 @@ func (srv *SocketServer) Start(tlsConfig *tls.Config) error {
 		ips = append(ips, cert.IPAddresses...)
 		emails = append(emails, cert.EmailAddresses...)
 		uris = append(uris, cert.URIs...)
+		ous := slices.Clone(cert.Subject.OrganizationalUnit)
 
 		c.Set("names", dnsNames)
 		c.Set("ips", ips)
 		c.Set("emails", emails)
 		c.Set("uris", uris)
+		c.Set("ous", ous)
 		c.Next()
 	})
 	router.StaticFS("/static", http.FS(srv.staticFS))
@@ -169,11 +281,42 @@ func (srv *SocketServer) Start(tlsConfig *tls.Config) error {
 			srv.logger.Error().Err(err).Msg("Failed to execute template")
 		}
 	})
+	router.GET("/api/groups", func(c *gin.Context) {
+		c.JSON(http.StatusOK, srv.connectionManager.Groups())
+	})
+	router.GET("/api/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, srv.connectionManager.Statuses())
+	})
+	router.GET("/metrics", srv.metrics)
+	router.GET("/api/emergency", func(c *gin.Context) {
+		emergency := srv.connectionManager.Emergency()
+		if emergency == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no active emergency"})
+			return
+		}
+		c.JSON(http.StatusOK, emergency)
+	})
+	// the routes are gated at request time, provisioning can be enabled by a reload
+	audit := router.Group("/api/audit", srv.auditEnabled, srv.adminOnly)
+	audit.GET("", srv.auditQuery)
+	audit.GET("/verify", srv.auditVerify)
+	router.POST("/provision", srv.provisioningEnabled, srv.bootstrapOnly, srv.provisionCreate)
+	router.GET("/provision/:id", srv.provisioningEnabled, srv.bootstrapOnly, srv.provisionResult)
+	provisionAdmin := router.Group("/api/provision", srv.provisioningEnabled, srv.provisionAdminOnly)
+	provisionAdmin.GET("", srv.provisionList)
+	provisionAdmin.POST("/:id/approve", srv.provisionApprove)
+	provisionAdmin.POST("/:id/reject", srv.provisionReject)
+	router.GET("/admin/provision", srv.provisioningEnabled, srv.provisionAdminOnly, srv.provisionPage)
 	router.GET("/echo", srv.echo)
 	router.GET("/ws/:name", srv.ws)
+	return router
+}
+
+func (srv *SocketServer) Start(tlsConfig *tls.Config) error {
+	srv.startWorkers()
 	srv.srv = &http.Server{
 		Addr:      srv.Addr,
-		Handler:   router,
+		Handler:   srv.handler(),
 		TLSConfig: tlsConfig,
 	}
 	go func() {
@@ -288,11 +431,11 @@ func (srv *SocketServer) _closeWSConn(wsConn *connection) {
 	srv.wsConnsMu.Lock()
 	defer srv.wsConnsMu.Unlock()
 	if conn, ok := srv.wsConns[wsConn.Name]; ok {
-		if conn.Conn.RemoteAddr() != wsConn.Conn.RemoteAddr() {
-			srv.logger.Debug().Msgf("connection %s[%s] already closed.", wsConn.Name, wsConn.Conn.RemoteAddr())
+		if conn != wsConn {
+			srv.logger.Debug().Msgf("connection %s[%s] already closed.", wsConn.Name, wsConn.Transport.RemoteAddr())
 			return
 		}
-		srv.logger.Debug().Msgf("Closing connection %s[%s]", wsConn.Name, wsConn.Conn.RemoteAddr())
+		srv.logger.Debug().Msgf("Closing connection %s[%s]", wsConn.Name, wsConn.Transport.RemoteAddr())
 		if err := conn.Close(); err != nil {
 			srv.logger.Error().Err(err).Msg("Failed to close connection")
 		}
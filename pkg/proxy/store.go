@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketGroups = []byte("groups")
+	bucketStatus = []byte("status")
+	bucketQueue  = []byte("queue")
+	bucketState  = []byte("state")
+	bucketIssued = []byte("issued")
+)
+
+var (
+	keyEmergency = []byte("emergency")
+	keyQueued    = []byte("queued")
+)
+
+// ErrQueueFull is returned by Enqueue, if the queues of all destinations contain the maximum number of events
+var ErrQueueFull = errors.New("queue full")
+
+// NewStore opens or creates the bbolt database at path
+func NewStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open store %s", path)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketGroups, bucketStatus, bucketQueue, bucketState, bucketIssued} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrapf(err, "cannot create bucket %s", string(name))
+			}
+		}
+		return setQueued(tx, queueLen(tx.Bucket(bucketQueue)))
+	}); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "cannot initialize store %s", path)
+	}
+	return &Store{db: db}, nil
+}
+
+// Store persists groups, the last status of the displays, queued events, the active emergency and the names
+// of provisioned displays
+type Store struct {
+	db *bolt.DB
+}
+
+// QueuedEvent is an event for an offline destination
+type QueuedEvent struct {
+	Time  time.Time    `json:"time"`
+	Event *event.Event `json:"event"`
+}
+
+func (s *Store) Close() error {
+	return errors.WithStack(s.db.Close())
+}
+
+// SaveGroup stores the members of a group, which joined with attach events
+func (s *Store) SaveGroup(group string, members []string) error {
+	if members == nil {
+		members = []string{}
+	}
+	return errors.WithStack(s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketGroups)
+		data, err := json.Marshal(members)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal members of group %s", group)
+		}
+		return b.Put([]byte(group), data)
+	}))
+}
+
+// Groups returns all stored groups with their members
+func (s *Store) Groups() (map[string][]string, error) {
+	var groups = make(map[string][]string)
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketGroups).ForEach(func(k, v []byte) error {
+			var members = []string{}
+			if err := json.Unmarshal(v, &members); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal members of group %s", string(k))
+			}
+			groups[string(k)] = members
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return groups, nil
+}
+
+// SaveStatus stores the last status of a display.
+// Concurrent calls are combined into a single transaction.
+func (s *Store) SaveStatus(name string, status json.RawMessage) error {
+	return errors.WithStack(s.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStatus).Put([]byte(name), status)
+	}))
+}
+
+// Statuses returns the last status of all displays
+func (s *Store) Statuses() (map[string]json.RawMessage, error) {
+	var statuses = make(map[string]json.RawMessage)
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStatus).ForEach(func(k, v []byte) error {
+			statuses[string(k)] = append(json.RawMessage{}, v...)
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return statuses, nil
+}
+
+// Enqueue appends an event to the queue of dest. If the queue contains more than maxEvents, the oldest events are removed.
+// If the queues of all destinations contain maxTotal events, ErrQueueFull is returned.
+func (s *Store) Enqueue(dest string, evt *event.Event, maxEvents int, maxTotal int) error {
+	data, err := json.Marshal(&QueuedEvent{Time: time.Now(), Event: evt})
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal event %s", evt)
+	}
+	return errors.WithStack(s.db.Update(func(tx *bolt.Tx) error {
+		queued := getQueued(tx)
+		if maxTotal > 0 && queued >= maxTotal {
+			return errors.Wrapf(ErrQueueFull, "cannot queue event for %s", dest)
+		}
+		queue := tx.Bucket(bucketQueue)
+		b, err := queue.CreateBucketIfNotExists([]byte(dest))
+		if err != nil {
+			return errors.Wrapf(err, "cannot create queue for %s", dest)
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return errors.Wrapf(err, "cannot get sequence of queue %s", dest)
+		}
+		if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+			return errors.Wrapf(err, "cannot queue event for %s", dest)
+		}
+		queued++
+		if maxEvents <= 0 {
+			return setQueued(tx, queued)
+		}
+		var keys = [][]byte{}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+		for i := 0; i < len(keys)-maxEvents; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return errors.Wrapf(err, "cannot remove old event from queue %s", dest)
+			}
+			queued--
+		}
+		return setQueued(tx, queued)
+	}))
+}
+
+// getQueued returns the number of events in the queues of all destinations
+func getQueued(tx *bolt.Tx) int {
+	data := tx.Bucket(bucketState).Get(keyQueued)
+	if len(data) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(data))
+}
+
+// setQueued stores the number of events in the queues of all destinations
+func setQueued(tx *bolt.Tx, n int) error {
+	if n < 0 {
+		n = 0
+	}
+	return errors.Wrap(tx.Bucket(bucketState).Put(keyQueued, binary.BigEndian.AppendUint64(nil, uint64(n))), "cannot store queue length")
+}
+
+// queueLen counts the events in the queues of all destinations
+func queueLen(queue *bolt.Bucket) int {
+	var n int
+	c := queue.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			continue
+		}
+		n += queue.Bucket(k).Stats().KeyN
+	}
+	return n
+}
+
+// Dequeue removes and returns all queued events of dest, which are not older than maxAge
+func (s *Store) Dequeue(dest string, maxAge time.Duration) ([]*QueuedEvent, error) {
+	var events = []*QueuedEvent{}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(bucketQueue)
+		b := queue.Bucket([]byte(dest))
+		if b == nil {
+			return nil
+		}
+		var n int
+		if err := b.ForEach(func(k, v []byte) error {
+			n++
+			var qe = &QueuedEvent{}
+			if err := json.Unmarshal(v, qe); err != nil {
+				return errors.Wrapf(err, "cannot unmarshal queued event for %s", dest)
+			}
+			if maxAge > 0 && time.Since(qe.Time) > maxAge {
+				return nil
+			}
+			events = append(events, qe)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := queue.DeleteBucket([]byte(dest)); err != nil {
+			return errors.Wrapf(err, "cannot remove queue %s", dest)
+		}
+		return setQueued(tx, getQueued(tx)-n)
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return events, nil
+}
+
+// SaveIssued stores the name of a display, which got a certificate by provisioning
+func (s *Store) SaveIssued(name string, issued time.Time) error {
+	return errors.WithStack(s.db.Update(func(tx *bolt.Tx) error {
+		data, err := issued.MarshalText()
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal issue time of %s", name)
+		}
+		return tx.Bucket(bucketIssued).Put([]byte(name), data)
+	}))
+}
+
+// Issued returns the names of all provisioned displays
+func (s *Store) Issued() ([]string, error) {
+	var names = []string{}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketIssued).ForEach(func(k, v []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return names, nil
+}
+
+// SaveEmergency stores the active emergency event, nil removes it
+func (s *Store) SaveEmergency(evt *event.Event) error {
+	return errors.WithStack(s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketState)
+		if evt == nil {
+			return b.Delete(keyEmergency)
+		}
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return errors.Wrapf(err, "cannot marshal event %s", evt)
+		}
+		return b.Put(keyEmergency, data)
+	}))
+}
+
+// Emergency returns the stored emergency event or nil
+func (s *Store) Emergency() (*event.Event, error) {
+	var evt *event.Event
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketState).Get(keyEmergency)
+		if data == nil {
+			return nil
+		}
+		evt = &event.Event{}
+		return errors.Wrap(json.Unmarshal(data, evt), "cannot unmarshal emergency event")
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return evt, nil
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+func newTestManager(t *testing.T, queueSize int, queueTotal int, playbackMaxAge time.Duration) (*connectionManager, *Store) {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	store, err := NewStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("cannot open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	manager := newConnectionManager(false, logger)
+	if err := manager.setStore(store, queueSize, queueTotal, time.Hour, playbackMaxAge); err != nil {
+		t.Fatalf("cannot set store: %v", err)
+	}
+	return manager, store
+}
+
+func TestGroupPersistence(t *testing.T) {
+	manager, store := newTestManager(t, 10, 100, time.Minute)
+	manager.AddToGroup("display01", "static")
+	manager.attach("display02", "lobby")
+	manager.attach("display01", "lobby")
+
+	groups, err := store.Groups()
+	if err != nil {
+		t.Fatalf("cannot load groups: %v", err)
+	}
+	if _, ok := groups["static"]; ok {
+		t.Fatalf("static group persisted: %v", groups)
+	}
+	if members := groups["lobby"]; !slices.Equal(members, []string{"display02", "display01"}) {
+		t.Fatalf("expected lobby members [display02 display01], got %v", members)
+	}
+
+	manager.RemoveFromGroups("display01")
+	if groups, err = store.Groups(); err != nil {
+		t.Fatalf("cannot load groups: %v", err)
+	}
+	if members := groups["lobby"]; !slices.Equal(members, []string{"display02"}) {
+		t.Fatalf("expected lobby members [display02] after detach, got %v", members)
+	}
+	if members := manager.Groups()["static"]; len(members) != 0 {
+		t.Fatalf("expected no static members, got %v", members)
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	manager, store := newTestManager(t, 10, 3, time.Nanosecond)
+	message := &event.Event{Type: event.TypeStringMessage, Target: "display01", Data: []byte(`"hello"`)}
+	if manager.enqueue("unknown", message) {
+		t.Fatal("event for an unknown destination queued")
+	}
+	manager.AddToGroup("display01", "lobby")
+	for _, evt := range []*event.Event{
+		{Type: event.TypeLoad, Target: "display01", Data: []byte(`"https://example.com/a.mp3"`)},
+		message,
+		{Type: event.TypeStatus, Target: "display01"},
+		message,
+	} {
+		manager.enqueue("display01", evt)
+	}
+	if manager.enqueue("display01", message) {
+		t.Fatal("event queued beyond the total limit")
+	}
+
+	// the load command is older than the playback age and not replayed
+	time.Sleep(time.Millisecond)
+	manager.flushQueue("display01")
+	var types []event.EventType
+	for len(manager.senderChannel) > 0 {
+		types = append(types, (<-manager.senderChannel).evt.GetType())
+	}
+	if !slices.Equal(types, []event.EventType{event.TypeStringMessage, event.TypeStringMessage}) {
+		t.Fatalf("expected two queued messages, got %v", types)
+	}
+	if events, err := store.Dequeue("display01", 0); err != nil || len(events) != 0 {
+		t.Fatalf("expected empty queue, got %d events: %v", len(events), err)
+	}
+}
+
+func TestQueueTotal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("cannot open store: %v", err)
+	}
+	message := &event.Event{Type: event.TypeStringMessage, Target: "display01", Data: []byte(`"hello"`)}
+	// the oldest events of display01 are removed and do not count
+	for i := 0; i < 4; i++ {
+		if err := store.Enqueue("display01", message, 2, 4); err != nil {
+			t.Fatalf("cannot queue event %d: %v", i, err)
+		}
+	}
+	if err := store.Enqueue("display02", message, 2, 4); err != nil {
+		t.Fatalf("cannot queue event: %v", err)
+	}
+	store.Close()
+
+	// the total is recounted on open
+	if store, err = NewStore(path); err != nil {
+		t.Fatalf("cannot reopen store: %v", err)
+	}
+	defer store.Close()
+	if err := store.Enqueue("display02", message, 2, 4); err != nil {
+		t.Fatalf("cannot queue event: %v", err)
+	}
+	if err := store.Enqueue("display03", message, 2, 4); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected queue full, got %v", err)
+	}
+	if events, err := store.Dequeue("display01", 0); err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d: %v", len(events), err)
+	}
+	if err := store.Enqueue("display03", message, 2, 4); err != nil {
+		t.Fatalf("cannot queue event after dequeue: %v", err)
+	}
+}
@@ -4,13 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
 	"time"
 
 	"emperror.dev/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
 )
 
 func (srv *SocketServer) ws(ctx *gin.Context) {
@@ -27,23 +28,51 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusNotFound, fmt.Sprintf("name %s not in names %v", name, names))
 		return
 	}
+	var uris = []*url.URL{}
+	if urisAny, ok := ctx.Get("uris"); ok {
+		uris = urisAny.([]*url.URL)
+	}
+	var ous = []string{}
+	if ousAny, ok := ctx.Get("ous"); ok {
+		ous = ousAny.([]string)
+	}
+	groups := srv.getGrouping().Groups(name, uris, ous)
 	conn, err := srv.upgrade(ctx, name, 10*time.Second)
 	if err != nil {
 		srv.logger.Error().Err(err).Msg("Failed to upgrade connection")
 		return
 	}
-	wsConn := newConnection(conn, name, true)
-	if err := srv.connectionManager.addWSConn(wsConn); err != nil {
+	if err := srv.Accept(name, transport.NewWebsocket(conn), true, groups); err != nil {
 		srv.logger.Error().Err(err).Msgf("Failed to add connection %s", name)
 		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to add connection"})
 		return
 	}
-	defer srv.connectionManager.closeWSConn(wsConn)
+}
+
+// Accept serves an authenticated connection, which is added to the given groups. It blocks until the connection is closed.
+func (srv *SocketServer) Accept(name string, t transport.Transport, secure bool, groups []string) error {
+	srv.startWorkers()
+	wsConn := newConnection(t, name, secure)
+	if err := srv.connectionManager.addWSConn(wsConn); err != nil {
+		return errors.Wrapf(err, "cannot add connection %s", name)
+	}
+	for _, group := range groups {
+		srv.logger.Debug().Msgf("assigning %s to group %s", name, group)
+		srv.connectionManager.AddToGroup(name, group)
+	}
+	srv.connectionManager.presence(event.TypeConnected, name)
+	srv.connectionManager.flushQueue(name)
+	srv.connectionManager.sendEmergency(name)
+	defer func() {
+		if srv.connectionManager.closeWSConn(wsConn) {
+			srv.connectionManager.presence(event.TypeDisconnected, name)
+		}
+	}()
 
 	for {
-		var evt = &event.Event{}
-		if err := conn.ReadJSON(evt); err != nil {
-			if websocket.IsCloseError(errors.Cause(err), websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+		evt, err := t.ReadEvent()
+		if err != nil {
+			if transport.IsClosed(err) {
 				srv.logger.Debug().Err(err).Msg("connection closed by client")
 			} else {
 				srv.logger.Error().Err(err).Msg("Failed to read message")
@@ -73,7 +102,7 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 				continue
 			}
 			raw := data.([]byte)
-			result, err := srv.ntpFunc(raw)
+			result, err := srv.ntp(raw)
 			if err != nil {
 				srv.logger.Error().Err(err).Msg("Failed to query ntp server")
 				jsonBytes, _ := json.Marshal(err.Error())
@@ -100,6 +129,7 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 		case event.TypeAttach:
 			if name != evt.GetSource() {
 				srv.logger.Error().Msgf("Attach event for %s on %s not allowed", evt.GetSource(), name)
+				srv.connectionManager.reject(name, evt, errors.New("source mismatch"))
 				continue
 			}
 			data, err := evt.GetData()
@@ -108,10 +138,17 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 				continue
 			}
 			group := data.(string)
-			srv.connectionManager.AddToGroup(name, group)
+			if !srv.getGrouping().CanAttach(group, groups) {
+				srv.logger.Warn().Msgf("%s not allowed to attach to group %s", name, group)
+				srv.connectionManager.reject(name, evt, errors.Errorf("group %s not assigned", group))
+				continue
+			}
+			srv.connectionManager.attach(name, group)
+			srv.connectionManager.audit(&job{evt: evt, dest: group, origin: name}, AuditApplied, nil)
 		case event.TypeDetach:
 			if name != evt.GetSource() {
 				srv.logger.Error().Msgf("Detach event for %s on %s not allowed", evt.GetSource(), name)
+				srv.connectionManager.reject(name, evt, errors.New("source mismatch"))
 				continue
 			}
 			data, err := evt.GetData()
@@ -121,8 +158,45 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 			}
 			group := data.(string)
 			srv.connectionManager.RemoveFromGroup(name, group)
+			srv.connectionManager.audit(&job{evt: evt, dest: group, origin: name}, AuditApplied, nil)
+		case event.TypeReload, event.TypeRestartBrowser, event.TypeRestartDisplay, event.TypeScreenPower, event.TypeConfigUpdate,
+			event.TypeGetLogs, event.TypeLogStream:
+			// displays authorize these commands by the source
+			if name != evt.GetSource() {
+				srv.logger.Error().Msgf("%s event for %s on %s not allowed", evt.GetType(), evt.GetSource(), name)
+				srv.connectionManager.reject(name, evt, errors.New("source mismatch"))
+				continue
+			}
+			if err := srv.connectionManager.forward(name, evt); err != nil {
+				srv.connectionManager.reject(name, evt, err)
+				srv.logger.Error().Err(err).Msg("Failed to send event")
+			}
+		case event.TypeEmergency, event.TypeEmergencyClear:
+			if name != evt.GetSource() {
+				srv.logger.Error().Msgf("%s event for %s on %s not allowed", evt.GetType(), evt.GetSource(), name)
+				srv.connectionManager.reject(name, evt, errors.New("source mismatch"))
+				continue
+			}
+			if !srv.isEmergencySender(name) {
+				srv.logger.Warn().Msgf("%s not allowed to send %s", name, evt.GetType())
+				srv.connectionManager.reject(name, evt, errors.New("not an emergency sender"))
+				continue
+			}
+			if err := srv.connectionManager.setEmergency(name, evt); err != nil {
+				srv.logger.Error().Err(err).Msgf("cannot apply %s from %s", evt.GetType(), name)
+				srv.connectionManager.reject(name, evt, err)
+				continue
+			}
+			srv.logger.Warn().Msgf("%s from %s sent to all connections", evt.GetType(), name)
 		default:
-			if err := srv.connectionManager.send(evt); err != nil {
+			switch evt.Type {
+			case event.TypeStatus:
+				srv.connectionManager.setStatus(name, evt.Data)
+			case event.TypeHealth:
+				srv.connectionManager.setHealth(name, evt.Data)
+			}
+			if err := srv.connectionManager.forward(name, evt); err != nil {
+				srv.connectionManager.reject(name, evt, err)
 				srv.logger.Error().Err(err).Msg("Failed to send event")
 			}
 		}
@@ -135,4 +209,5 @@ func (srv *SocketServer) ws(ctx *gin.Context) {
 
 		*/
 	}
+	return nil
 }
@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// testClient is a client connected to the proxy with an in-memory pipe
+type testClient struct {
+	name   string
+	end    *transport.PipeEnd
+	events chan *event.Event
+}
+
+func newTestServer(t *testing.T) *SocketServer {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	srv, err := NewSocketServer("", "", 2, "", nil, nil, false, logger)
+	if err != nil {
+		t.Fatalf("cannot create server: %v", err)
+	}
+	t.Cleanup(srv.connectionManager.close)
+	return srv
+}
+
+// connect accepts a pipe connection of name with the given groups and collects its events
+func connect(t *testing.T, srv *SocketServer, name string, groups ...string) *testClient {
+	clientEnd, proxyEnd := transport.Pipe(name, "proxy")
+	c := &testClient{name: name, end: clientEnd, events: make(chan *event.Event, 100)}
+	accepted := make(chan struct{})
+	go func() {
+		defer close(accepted)
+		if err := srv.Accept(name, proxyEnd, true, groups); err != nil {
+			t.Errorf("cannot accept %s: %v", name, err)
+		}
+	}()
+	go func() {
+		defer close(c.events)
+		for {
+			evt, err := clientEnd.ReadEvent()
+			if err != nil {
+				return
+			}
+			c.events <- evt
+		}
+	}()
+	t.Cleanup(func() {
+		clientEnd.Close()
+		<-accepted
+	})
+	return c
+}
+
+func (c *testClient) send(t *testing.T, evt *event.Event) {
+	t.Helper()
+	if err := c.end.WriteEvent(evt); err != nil {
+		t.Fatalf("%s cannot send %s: %v", c.name, evt.GetType(), err)
+	}
+}
+
+// expect waits for the next event of type evtType and returns it
+func (c *testClient) expect(t *testing.T, evtType event.EventType) *event.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case evt, ok := <-c.events:
+			if !ok {
+				t.Fatalf("%s closed while waiting for %s", c.name, evtType)
+			}
+			if evt.GetType() == evtType {
+				return evt
+			}
+		case <-timeout:
+			t.Fatalf("%s: no %s event", c.name, evtType)
+		}
+	}
+}
+
+// expectNone fails if an event of type evtType arrives within a short time
+func (c *testClient) expectNone(t *testing.T, evtType event.EventType) {
+	t.Helper()
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case evt, ok := <-c.events:
+			if !ok {
+				return
+			}
+			if evt.GetType() == evtType {
+				t.Fatalf("%s: unexpected %s event from %s", c.name, evtType, evt.GetSource())
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func groupEvent(t event.EventType, source, group string) *event.Event {
+	jsonBytes, _ := json.Marshal(group)
+	return &event.Event{Type: t, Source: source, Data: jsonBytes}
+}
+
+func stringData(t *testing.T, evt *event.Event) string {
+	t.Helper()
+	var str string
+	if err := json.Unmarshal(evt.Data, &str); err != nil {
+		t.Fatalf("cannot unmarshal data of %s: %v", evt.GetType(), err)
+	}
+	return str
+}
+
+func TestPresence(t *testing.T) {
+	srv := newTestServer(t)
+	core := connect(t, srv, "core01", "core")
+	core.expect(t, event.TypeConnected)
+
+	display := connect(t, srv, "display01")
+	if name := stringData(t, core.expect(t, event.TypeConnected)); name != "display01" {
+		t.Fatalf("expected connected display01, got %s", name)
+	}
+	display.end.Close()
+	if name := stringData(t, core.expect(t, event.TypeDisconnected)); name != "display01" {
+		t.Fatalf("expected disconnected display01, got %s", name)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	srv := newTestServer(t)
+	core := connect(t, srv, "core01", "core")
+	core.expect(t, event.TypeConnected)
+	display := connect(t, srv, "display01", "core")
+	core.expect(t, event.TypeConnected)
+
+	// direct events reach the named client only
+	core.send(t, &event.Event{Type: event.TypeStringMessage, Source: "core01", Target: "display01", Data: []byte(`"hello"`)})
+	if str := stringData(t, display.expect(t, event.TypeStringMessage)); str != "hello" {
+		t.Fatalf("expected hello, got %s", str)
+	}
+	core.expectNone(t, event.TypeStringMessage)
+
+	// group events reach all members
+	display.send(t, &event.Event{Type: event.TypeStringMessage, Source: "display01", Target: "core", Data: []byte(`"to core"`)})
+	if evt := core.expect(t, event.TypeStringMessage); evt.GetSource() != "display01" {
+		t.Fatalf("expected source display01, got %s", evt.GetSource())
+	}
+	display.expect(t, event.TypeStringMessage)
+}
+
+func TestGroupAttach(t *testing.T) {
+	srv := newTestServer(t)
+	srv.SetGrouping(&Grouping{})
+	core := connect(t, srv, "core01", "core")
+	core.expect(t, event.TypeConnected)
+	display := connect(t, srv, "display01", "lobby")
+	core.expect(t, event.TypeConnected)
+
+	// the display may join its assigned group, but not others or on behalf of other clients
+	display.send(t, groupEvent(event.TypeAttach, "display01", "hall"))
+	display.send(t, groupEvent(event.TypeAttach, "core01", "lobby"))
+	display.send(t, groupEvent(event.TypeDetach, "display01", "lobby"))
+	display.send(t, groupEvent(event.TypeAttach, "display01", "lobby"))
+	// the events of a connection are handled in order, the message arrives after the group changes
+	display.send(t, &event.Event{Type: event.TypeStringMessage, Source: "display01", Target: "core01", Data: []byte(`"done"`)})
+	core.expect(t, event.TypeStringMessage)
+
+	core.send(t, &event.Event{Type: event.TypeStringMessage, Source: "core01", Target: "lobby", Data: []byte(`"lobby"`)})
+	display.expect(t, event.TypeStringMessage)
+	groups := srv.connectionManager.Groups()
+	if members := groups["lobby"]; len(members) != 1 || members[0] != "display01" {
+		t.Fatalf("expected lobby members [display01], got %v", members)
+	}
+	if members := groups["hall"]; len(members) != 0 {
+		t.Fatalf("expected no hall members, got %v", members)
+	}
+}
+
+func TestCommandSource(t *testing.T) {
+	srv := newTestServer(t)
+	core := connect(t, srv, "core01", "core")
+	core.expect(t, event.TypeConnected)
+	page := connect(t, srv, "page01", "core")
+	core.expect(t, event.TypeConnected)
+	display := connect(t, srv, "display01", "core")
+	core.expect(t, event.TypeConnected)
+
+	// a command with the source of another client is dropped, the next one of the sender arrives
+	for _, evtType := range []event.EventType{event.TypeConfigUpdate, event.TypeReload, event.TypeGetLogs, event.TypeLogStream} {
+		page.send(t, &event.Event{Type: evtType, Source: "core01", Target: "display01", Data: []byte(`"{}"`)})
+		core.send(t, &event.Event{Type: evtType, Source: "core01", Target: "display01", Data: []byte(`"{}"`)})
+		if evt := display.expect(t, evtType); evt.GetSource() != "core01" {
+			t.Fatalf("%s: expected source core01, got %s", evtType, evt.GetSource())
+		}
+		display.expectNone(t, evtType)
+	}
+}
+
+func TestEmergencySenders(t *testing.T) {
+	srv := newTestServer(t)
+	core := connect(t, srv, "core01", "core")
+	core.expect(t, event.TypeConnected)
+	display := connect(t, srv, "display01", "core")
+	core.expect(t, event.TypeConnected)
+
+	emergency := func(source string) *event.Event {
+		evt, err := event.NewPageEvent(event.TypeEmergency, "", &event.Emergency{ID: "e1", Title: "fire"})
+		if err != nil {
+			t.Fatalf("cannot create emergency: %v", err)
+		}
+		evt.Source = source
+		return evt
+	}
+	// without senders nobody may send an emergency
+	core.send(t, emergency("core01"))
+	display.expectNone(t, event.TypeEmergency)
+
+	srv.SetEmergencySenders([]string{"core01"})
+	display.send(t, emergency("display01"))
+	core.expectNone(t, event.TypeEmergency)
+	core.send(t, emergency("core01"))
+	display.expect(t, event.TypeEmergency)
+}
+
+func TestRemoveStaticMember(t *testing.T) {
+	srv := newTestServer(t)
+	srv.AddToGroup("display01", "hall")
+	srv.AddToGroup("display02", "hall")
+	srv.connectionManager.attach("display02", "hall")
+
+	// a static member is removed, a member by attach stays
+	srv.RemoveFromGroup("display01", "hall")
+	srv.RemoveFromGroup("display02", "hall")
+	if members := srv.connectionManager.Groups()["hall"]; len(members) != 1 || members[0] != "display02" {
+		t.Fatalf("expected hall members [display02], got %v", members)
+	}
+}
@@ -0,0 +1,109 @@
+package reload
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// NewWatcher calls reload on SIGHUP and, if interval is not 0, when the modification time of path changes
+func NewWatcher(path string, interval time.Duration, reload func(), logger zLogger.ZLogger) *Watcher {
+	return &Watcher{
+		path:      path,
+		interval:  interval,
+		reload:    reload,
+		logger:    logger,
+		closeChan: make(chan struct{}),
+	}
+}
+
+// Watcher triggers configuration reloads
+type Watcher struct {
+	path      string
+	interval  time.Duration
+	reload    func()
+	logger    zLogger.ZLogger
+	closeChan chan struct{}
+	wg        sync.WaitGroup
+}
+
+func (w *Watcher) Start() {
+	w.wg.Add(1)
+	go w.run()
+}
+
+func (w *Watcher) Stop() {
+	close(w.closeChan)
+	w.wg.Wait()
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	var modTime time.Time
+	if w.interval > 0 && w.path != "" {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		modTime = w.modTime()
+	}
+	for {
+		select {
+		case <-w.closeChan:
+			return
+		case <-hup:
+			w.logger.Info().Msg("SIGHUP received, reloading configuration")
+			w.reload()
+			modTime = w.modTime()
+		case <-tick:
+			current := w.modTime()
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			w.logger.Info().Msgf("%s changed, reloading configuration", w.path)
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) modTime() time.Time {
+	if w.path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// SetLogLevel changes the level of all loggers. The loggers must be created with the lowest level.
+func SetLogLevel(level string) error {
+	lvl, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(lvl)
+	return nil
+}
+
+// ParseLogLevel checks a level name like debug or info
+func ParseLogLevel(level string) (zerolog.Level, error) {
+	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return zerolog.NoLevel, errors.Wrapf(err, "invalid log level %s", level)
+	}
+	return lvl, nil
+}
@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/BurntSushi/toml"
+)
+
+type LoopRule string
+
+const (
+	// LoopNone plays the playlist once and stops
+	LoopNone LoopRule = "none"
+	// LoopPlaylist restarts the playlist after the last item
+	LoopPlaylist LoopRule = "playlist"
+	// LoopItem repeats the current item
+	LoopItem LoopRule = "item"
+)
+
+// Duration is a time.Duration which can be read from toml and json strings like "5m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	dur, err := time.ParseDuration(string(text))
+	if err != nil {
+		return errors.Wrapf(err, "invalid duration %s", string(text))
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Clock is a time of day in minutes after midnight, written as "15:04"
+type Clock int
+
+func (c *Clock) UnmarshalText(text []byte) error {
+	t, err := time.Parse("15:04", string(text))
+	if err != nil {
+		return errors.Wrapf(err, "invalid time of day %s", string(text))
+	}
+	*c = Clock(t.Hour()*60 + t.Minute())
+	return nil
+}
+
+func (c Clock) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%02d:%02d", int(c)/60, int(c)%60)), nil
+}
+
+type Item struct {
+	URL string `toml:"url" json:"url"`
+	// Duration of the item. If zero, the next item starts after an "ended" event of the target display.
+	// Items for groups need a duration, their displays do not report a common end.
+	Duration Duration `toml:"duration" json:"duration"`
+	// Token is the signed content manifest of the url, if required by the displays
+	Token string `toml:"token" json:"token,omitempty"`
+	// Checksum is the sha256 (hex) of the content, verified by the display cache
+	Checksum string `toml:"checksum" json:"checksum,omitempty"`
+	// FadeIn starts the item with a fade-in instead of play
+	FadeIn Duration `toml:"fade_in" json:"fadeIn,omitempty"`
+	// FadeOut ends an item with duration by a fade-out
+	FadeOut Duration `toml:"fade_out" json:"fadeOut,omitempty"`
+}
+
+type Playlist struct {
+	Name  string   `toml:"name" json:"name"`
+	Loop  LoopRule `toml:"loop" json:"loop"`
+	Items []*Item  `toml:"item" json:"items"`
+}
+
+// Entry assigns a playlist to groups or displays within a weekly time window
+type Entry struct {
+	Playlist string   `toml:"playlist" json:"playlist"`
+	Targets  []string `toml:"targets" json:"targets"`
+	// Days are the weekdays (mon, tue, ...) of the window, empty means every day
+	Days     []string `toml:"days" json:"days"`
+	Start    Clock    `toml:"start" json:"start"`
+	End      Clock    `toml:"end" json:"end"`
+	Priority int      `toml:"priority" json:"priority"`
+	weekdays []time.Weekday
+}
+
+type Definition struct {
+	Timezone  string      `toml:"timezone" json:"timezone"`
+	Playlists []*Playlist `toml:"playlist" json:"playlists"`
+	Schedule  []*Entry    `toml:"schedule" json:"schedule"`
+	location  *time.Location
+	playlists map[string]*Playlist
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// LoadDefinition reads a schedule definition from a toml or json (.json) file
+func LoadDefinition(fp string) (*Definition, error) {
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read %s", fp)
+	}
+	def := &Definition{}
+	if strings.ToLower(filepath.Ext(fp)) == ".json" {
+		if err := json.Unmarshal(data, def); err != nil {
+			return nil, errors.Wrapf(err, "cannot decode %s", fp)
+		}
+	} else {
+		if _, err := toml.Decode(string(data), def); err != nil {
+			return nil, errors.Wrapf(err, "cannot decode %s", fp)
+		}
+	}
+	if err := def.init(); err != nil {
+		return nil, errors.Wrapf(err, "invalid schedule definition %s", fp)
+	}
+	return def, nil
+}
+
+func (def *Definition) init() error {
+	var err error
+	def.location = time.Local
+	if def.Timezone != "" {
+		if def.location, err = time.LoadLocation(def.Timezone); err != nil {
+			return errors.Wrapf(err, "invalid timezone %s", def.Timezone)
+		}
+	}
+	def.playlists = make(map[string]*Playlist)
+	for _, pl := range def.Playlists {
+		if pl.Name == "" {
+			return errors.New("playlist without name")
+		}
+		if _, ok := def.playlists[pl.Name]; ok {
+			return errors.Errorf("duplicate playlist %s", pl.Name)
+		}
+		switch pl.Loop {
+		case "":
+			pl.Loop = LoopNone
+		case LoopNone, LoopPlaylist, LoopItem:
+		default:
+			return errors.Errorf("invalid loop rule %s in playlist %s", pl.Loop, pl.Name)
+		}
+		if len(pl.Items) == 0 {
+			return errors.Errorf("playlist %s has no items", pl.Name)
+		}
+		for idx, item := range pl.Items {
+			if item.URL == "" {
+				return errors.Errorf("item #%d of playlist %s has no url", idx, pl.Name)
+			}
+			if item.FadeIn < 0 || item.FadeOut < 0 {
+				return errors.Errorf("item #%d of playlist %s has a negative fade", idx, pl.Name)
+			}
+			if item.FadeOut > item.Duration {
+				return errors.Errorf("fade-out of item #%d of playlist %s is longer than its duration", idx, pl.Name)
+			}
+		}
+		def.playlists[pl.Name] = pl
+	}
+	for idx, entry := range def.Schedule {
+		if _, ok := def.playlists[entry.Playlist]; !ok {
+			return errors.Errorf("schedule entry #%d: unknown playlist %s", idx, entry.Playlist)
+		}
+		if len(entry.Targets) == 0 {
+			return errors.Errorf("schedule entry #%d has no targets", idx)
+		}
+		entry.weekdays = []time.Weekday{}
+		for _, day := range entry.Days {
+			wd, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return errors.Errorf("schedule entry #%d: invalid day %s", idx, day)
+			}
+			entry.weekdays = append(entry.weekdays, wd)
+		}
+	}
+	return nil
+}
+
+// Playlist returns the playlist with the given name
+func (def *Definition) Playlist(name string) (*Playlist, bool) {
+	pl, ok := def.playlists[name]
+	return pl, ok
+}
+
+// Targets returns all targets of the schedule
+func (def *Definition) Targets() []string {
+	var targets = []string{}
+	for _, entry := range def.Schedule {
+		for _, target := range entry.Targets {
+			if !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// Active checks whether the time window of the entry contains t.
+// A window with end before start spans midnight and belongs to the day it starts.
+func (entry *Entry) Active(t time.Time) bool {
+	minute := Clock(t.Hour()*60 + t.Minute())
+	day := t.Weekday()
+	switch {
+	case entry.Start == entry.End:
+		// whole day
+	case entry.Start < entry.End:
+		if minute < entry.Start || minute >= entry.End {
+			return false
+		}
+	default:
+		if minute < entry.Start && minute >= entry.End {
+			return false
+		}
+		if minute < entry.End {
+			day = (day + 6) % 7
+		}
+	}
+	return len(entry.weekdays) == 0 || slices.Contains(entry.weekdays, day)
+}
+
+// ActiveEntry returns the active entry with the highest priority for target
+func (def *Definition) ActiveEntry(target string, t time.Time) *Entry {
+	t = t.In(def.location)
+	var result *Entry
+	for _, entry := range def.Schedule {
+		if !slices.Contains(entry.Targets, target) || !entry.Active(t) {
+			continue
+		}
+		if result == nil || entry.Priority > result.Priority {
+			result = entry
+		}
+	}
+	return result
+}
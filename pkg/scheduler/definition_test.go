@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// newDefinition decodes and checks a toml definition
+func newDefinition(t *testing.T, src string) *Definition {
+	t.Helper()
+	def := &Definition{}
+	if _, err := toml.Decode(src, def); err != nil {
+		t.Fatalf("cannot decode definition: %v", err)
+	}
+	if err := def.init(); err != nil {
+		t.Fatalf("invalid definition: %v", err)
+	}
+	return def
+}
+
+const testPlaylists = `
+[[playlist]]
+name = "a"
+[[playlist.item]]
+url = "https://localhost/a.mp3"
+duration = "1m"
+
+[[playlist]]
+name = "b"
+loop = "playlist"
+[[playlist.item]]
+url = "https://localhost/b1.mp3"
+[[playlist.item]]
+url = "https://localhost/b2.mp3"
+`
+
+func TestActive(t *testing.T) {
+	def := newDefinition(t, testPlaylists+`
+[[schedule]]
+playlist = "a"
+targets = ["night"]
+days = ["mon"]
+start = "22:00"
+end = "02:00"
+
+[[schedule]]
+playlist = "a"
+targets = ["day"]
+start = "10:00"
+end = "17:00"
+
+[[schedule]]
+playlist = "a"
+targets = ["weekend"]
+days = ["Saturday", "sun"]
+start = "00:00"
+end = "00:00"
+`)
+	night, day, weekend := def.Schedule[0], def.Schedule[1], def.Schedule[2]
+	// 2024-01-01 is a monday
+	at := func(dayOfMonth, hour, minute int) time.Time {
+		return time.Date(2024, 1, dayOfMonth, hour, minute, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		name   string
+		entry  *Entry
+		t      time.Time
+		active bool
+	}{
+		{"night before midnight", night, at(1, 23, 0), true},
+		{"night after midnight belongs to monday", night, at(2, 1, 59), true},
+		{"night end is exclusive", night, at(2, 2, 0), false},
+		{"night after midnight of sunday", night, at(1, 1, 0), false},
+		{"night before start", night, at(1, 21, 59), false},
+		{"night on tuesday", night, at(2, 23, 0), false},
+		{"day start", day, at(3, 10, 0), true},
+		{"day before end", day, at(3, 16, 59), true},
+		{"day end", day, at(3, 17, 0), false},
+		{"day before start", day, at(3, 9, 59), false},
+		{"weekend saturday", weekend, at(6, 12, 0), true},
+		{"weekend sunday midnight", weekend, at(7, 0, 0), true},
+		{"weekend monday", weekend, at(8, 0, 0), false},
+	} {
+		if active := test.entry.Active(test.t); active != test.active {
+			t.Errorf("%s: expected active %v at %s, got %v", test.name, test.active, test.t.Format(time.RFC3339), active)
+		}
+	}
+}
+
+func TestActiveEntry(t *testing.T) {
+	def := newDefinition(t, `timezone = "Europe/Zurich"`+testPlaylists+`
+[[schedule]]
+playlist = "a"
+targets = ["hall-a", "display01"]
+start = "00:00"
+end = "00:00"
+
+[[schedule]]
+playlist = "b"
+targets = ["hall-a"]
+start = "10:00"
+end = "12:00"
+priority = 10
+`)
+	for _, test := range []struct {
+		name     string
+		target   string
+		t        time.Time
+		playlist string
+	}{
+		// 09:30 UTC is 10:30 in Zurich in winter
+		{"higher priority", "hall-a", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), "b"},
+		{"before the window in local time", "hall-a", time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC), "a"},
+		// 09:30 UTC is 11:30 in Zurich in summer
+		{"summer time", "hall-a", time.Date(2024, 7, 1, 9, 30, 0, 0, time.UTC), "b"},
+		{"after the window in summer time", "hall-a", time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC), "a"},
+		{"other target", "display01", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), "a"},
+		{"unknown target", "display02", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), ""},
+	} {
+		var playlist string
+		if entry := def.ActiveEntry(test.target, test.t); entry != nil {
+			playlist = entry.Playlist
+		}
+		if playlist != test.playlist {
+			t.Errorf("%s: expected playlist %q, got %q", test.name, test.playlist, playlist)
+		}
+	}
+}
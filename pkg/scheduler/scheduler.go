@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/event"
+	"github.com/je4/utils/v2/pkg/zLogger"
+)
+
+// run is the playback state of an entry on a target
+type run struct {
+	entry    *Entry
+	playlist *Playlist
+	item     int
+	// itemEnd is zero if the item waits for an "ended" event
+	itemEnd time.Time
+	// fadingOut is set, if the fade-out of the item is sent
+	fadingOut bool
+	done      bool
+}
+
+func NewScheduler(def *Definition, comm *client.Communication, logger zLogger.ZLogger) *Scheduler {
+	return &Scheduler{
+		def:       def,
+		comm:      comm,
+		logger:    logger,
+		runs:      make(map[string]*run),
+		closeChan: make(chan struct{}),
+		endedChan: make(chan string, 10),
+	}
+}
+
+// Scheduler sends load/play/stop events to the targets of a schedule definition
+type Scheduler struct {
+	def       *Definition
+	defMu     sync.Mutex
+	comm      *client.Communication
+	logger    zLogger.ZLogger
+	runs      map[string]*run
+	closeChan chan struct{}
+	endedChan chan string
+	wg        sync.WaitGroup
+}
+
+// SetDefinition replaces the schedule definition. Running playlists are restarted on the next tick.
+func (s *Scheduler) SetDefinition(def *Definition) {
+	s.defMu.Lock()
+	defer s.defMu.Unlock()
+	s.def = def
+}
+
+func (s *Scheduler) getDefinition() *Definition {
+	s.defMu.Lock()
+	defer s.defMu.Unlock()
+	return s.def
+}
+
+// Ended must be called if an "ended" event from source is received
+func (s *Scheduler) Ended(source string) {
+	select {
+	case s.endedChan <- source:
+	default:
+		s.logger.Warn().Msgf("ended channel full, dropping ended event from %s", source)
+	}
+}
+
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.tick(time.Now())
+		for {
+			select {
+			case <-s.closeChan:
+				return
+			case source := <-s.endedChan:
+				s.ended(source)
+			case now := <-time.After(time.Second):
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and all running playlists
+func (s *Scheduler) Stop() {
+	close(s.closeChan)
+	s.wg.Wait()
+	for target := range s.runs {
+		s.stop(target)
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	def := s.getDefinition()
+	targets := def.Targets()
+	for target := range s.runs {
+		if !slices.Contains(targets, target) {
+			s.stop(target)
+		}
+	}
+	for _, target := range targets {
+		entry := def.ActiveEntry(target, now)
+		r, ok := s.runs[target]
+		switch {
+		case entry == nil:
+			if ok {
+				s.logger.Info().Msgf("schedule for %s ended", target)
+				s.stop(target)
+			}
+		case !ok || r.entry != entry:
+			playlist, _ := def.Playlist(entry.Playlist)
+			s.logger.Info().Msgf("starting playlist %s on %s", playlist.Name, target)
+			r = &run{
+				entry:    entry,
+				playlist: playlist,
+				item:     0,
+			}
+			s.runs[target] = r
+			s.prefetch(target, playlist)
+			s.play(target, r, now)
+		case !r.done && !r.itemEnd.IsZero() && !now.Before(r.itemEnd):
+			s.next(target, r, now)
+		case !r.done && !r.fadingOut && !r.itemEnd.IsZero() && !now.Before(r.itemEnd.Add(-time.Duration(r.playlist.Items[r.item].FadeOut))):
+			s.fadeOut(target, r)
+		}
+	}
+}
+
+// ended advances the run of the display source. Runs of groups are not advanced, the first display
+// of a group to end would skip the item for all others.
+func (s *Scheduler) ended(source string) {
+	r, ok := s.runs[source]
+	if !ok || r.done || !r.itemEnd.IsZero() {
+		return
+	}
+	s.next(source, r, time.Now())
+}
+
+// next advances to the next item according to the loop rule
+func (s *Scheduler) next(target string, r *run, now time.Time) {
+	switch r.playlist.Loop {
+	case LoopItem:
+	case LoopPlaylist:
+		r.item = (r.item + 1) % len(r.playlist.Items)
+	default:
+		r.item++
+		if r.item >= len(r.playlist.Items) {
+			s.logger.Info().Msgf("playlist %s on %s finished", r.playlist.Name, target)
+			r.done = true
+			if err := s.send(event.TypeStop, target, nil, ""); err != nil {
+				s.logger.Error().Err(err).Msgf("cannot stop %s", target)
+			}
+			return
+		}
+	}
+	s.play(target, r, now)
+}
+
+func (s *Scheduler) play(target string, r *run, now time.Time) {
+	item := r.playlist.Items[r.item]
+	r.itemEnd = time.Time{}
+	r.fadingOut = false
+	if item.Duration > 0 {
+		r.itemEnd = now.Add(time.Duration(item.Duration))
+	}
+	s.logger.Debug().Msgf("playing item #%d %s of %s on %s", r.item, item.URL, r.playlist.Name, target)
+	if err := s.send(event.TypeLoad, target, item.URL, item.Token); err != nil {
+		s.logger.Error().Err(err).Msgf("cannot load %s on %s", item.URL, target)
+		return
+	}
+	if item.FadeIn > 0 {
+		if err := s.send(event.TypeFadeIn, target, &event.Fade{Duration: time.Duration(item.FadeIn).Seconds()}, ""); err != nil {
+			s.logger.Error().Err(err).Msgf("cannot fade in %s on %s", item.URL, target)
+		}
+		return
+	}
+	if err := s.send(event.TypePlay, target, nil, ""); err != nil {
+		s.logger.Error().Err(err).Msgf("cannot play %s on %s", item.URL, target)
+	}
+}
+
+// fadeOut fades the current item out before its end
+func (s *Scheduler) fadeOut(target string, r *run) {
+	r.fadingOut = true
+	item := r.playlist.Items[r.item]
+	if err := s.send(event.TypeFadeOut, target, &event.Fade{Duration: time.Duration(item.FadeOut).Seconds()}, ""); err != nil {
+		s.logger.Error().Err(err).Msgf("cannot fade out %s on %s", item.URL, target)
+	}
+}
+
+// prefetch announces all items of the playlist to the caches of the target displays
+func (s *Scheduler) prefetch(target string, playlist *Playlist) {
+	for _, item := range playlist.Items {
+		if err := s.send(event.TypePrefetch, target, &event.Prefetch{URL: item.URL, Checksum: item.Checksum}, item.Token); err != nil {
+			s.logger.Error().Err(err).Msgf("cannot prefetch %s on %s", item.URL, target)
+		}
+	}
+}
+
+func (s *Scheduler) stop(target string) {
+	delete(s.runs, target)
+	if err := s.send(event.TypeStop, target, nil, ""); err != nil {
+		s.logger.Error().Err(err).Msgf("cannot stop %s", target)
+	}
+	if err := s.send(event.TypeUnload, target, nil, ""); err != nil {
+		s.logger.Error().Err(err).Msgf("cannot unload %s", target)
+	}
+}
+
+func (s *Scheduler) send(t event.EventType, target string, data interface{}, token string) error {
+	evt, err := event.NewPageEvent(t, target, data)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create %s event", t)
+	}
+	evt.Token = token
+	return errors.WithStack(s.comm.Send(evt))
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/je4/securedisplay/pkg/client"
+	"github.com/je4/securedisplay/pkg/transport"
+	"github.com/je4/utils/v2/pkg/zLogger"
+	"github.com/rs/zerolog"
+)
+
+// newTestScheduler creates a scheduler, whose events are read and dropped at the other end of a pipe
+func newTestScheduler(t *testing.T, def *Definition) *Scheduler {
+	l2 := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.InfoLevel)
+	var logger zLogger.ZLogger = &l2
+	schedulerEnd, proxyEnd := transport.Pipe("scheduler01", "proxy")
+	go func() {
+		for {
+			if _, err := proxyEnd.ReadEvent(); err != nil {
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { schedulerEnd.Close() })
+	return NewScheduler(def, client.NewCommunication(schedulerEnd, "scheduler01", logger), logger)
+}
+
+func TestEnded(t *testing.T) {
+	def := newDefinition(t, testPlaylists+`
+[[playlist]]
+name = "once"
+[[playlist.item]]
+url = "https://localhost/once.mp3"
+
+[[playlist]]
+name = "repeat"
+loop = "item"
+[[playlist.item]]
+url = "https://localhost/r1.mp3"
+[[playlist.item]]
+url = "https://localhost/r2.mp3"
+
+[[schedule]]
+playlist = "b"
+targets = ["hall-a", "display01"]
+
+[[schedule]]
+playlist = "once"
+targets = ["display02"]
+
+[[schedule]]
+playlist = "repeat"
+targets = ["display03"]
+`)
+	s := newTestScheduler(t, def)
+	s.tick(time.Now())
+	for _, target := range []string{"hall-a", "display01", "display02", "display03"} {
+		if r, ok := s.runs[target]; !ok || r.item != 0 {
+			t.Fatalf("%s: expected a run at item 0", target)
+		}
+	}
+
+	// the ended event of a display advances its own run only
+	s.ended("display01")
+	if item := s.runs["display01"].item; item != 1 {
+		t.Fatalf("display01: expected item 1, got %d", item)
+	}
+	if item := s.runs["hall-a"].item; item != 0 {
+		t.Fatalf("hall-a advanced by display01 to item %d", item)
+	}
+	// loop playlist starts again
+	s.ended("display01")
+	if item := s.runs["display01"].item; item != 0 {
+		t.Fatalf("display01: expected item 0 after the last item, got %d", item)
+	}
+	// no loop stops after the last item
+	s.ended("display02")
+	if !s.runs["display02"].done {
+		t.Fatal("display02: playlist not finished")
+	}
+	s.ended("display02")
+	// loop item repeats the current item
+	s.ended("display03")
+	if item := s.runs["display03"].item; item != 0 || s.runs["display03"].done {
+		t.Fatalf("display03: expected item 0 repeated, got %d", item)
+	}
+}
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"encoding/json"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// Pipe creates an in-memory transport. Events written to one end can be read from the other.
+// Events are json encoded to avoid shared data between both ends. Closing one end closes both,
+// events already written can still be read.
+func Pipe(nameA, nameB string) (*PipeEnd, *PipeEnd) {
+	ab := make(chan []byte, 16)
+	ba := make(chan []byte, 16)
+	p := &pipe{done: make(chan struct{})}
+	return &PipeEnd{pipe: p, in: ba, out: ab, remote: nameB},
+		&PipeEnd{pipe: p, in: ab, out: ba, remote: nameA}
+}
+
+type pipe struct {
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type PipeEnd struct {
+	pipe   *pipe
+	in     <-chan []byte
+	out    chan<- []byte
+	remote string
+}
+
+// ReadEvent returns the next event. After a close the events written before are still delivered.
+func (p *PipeEnd) ReadEvent() (*event.Event, error) {
+	var data []byte
+	select {
+	case data = <-p.in:
+	case <-p.pipe.done:
+		// drain the buffer like a socket, which delivers the data received before the close
+		select {
+		case data = <-p.in:
+		default:
+			return nil, ErrClosed
+		}
+	}
+	var evt = &event.Event{}
+	if err := json.Unmarshal(data, evt); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal event")
+	}
+	return evt, nil
+}
+
+func (p *PipeEnd) WriteEvent(evt *event.Event) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return errors.Wrapf(err, "cannot marshal event %s", evt)
+	}
+	// do not write to a closed pipe, even if the buffer has space
+	select {
+	case <-p.pipe.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case p.out <- data:
+		return nil
+	case <-p.pipe.done:
+		return ErrClosed
+	}
+}
+
+func (p *PipeEnd) Close() error {
+	p.pipe.closeOnce.Do(func() {
+		close(p.pipe.done)
+	})
+	return nil
+}
+
+func (p *PipeEnd) RemoteAddr() string {
+	return "pipe:" + p.remote
+}
+
+var _ Transport = (*PipeEnd)(nil)
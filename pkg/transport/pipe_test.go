@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+func TestPipeCloseDeliversBuffered(t *testing.T) {
+	a, b := Pipe("a", "b")
+	for _, target := range []string{"one", "two"} {
+		if err := a.WriteEvent(&event.Event{Type: event.TypeStatus, Source: "a", Target: target}); err != nil {
+			t.Fatalf("cannot write event: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("cannot close pipe: %v", err)
+	}
+	if err := a.WriteEvent(&event.Event{Type: event.TypeStatus}); !IsClosed(err) {
+		t.Fatalf("write after close: expected closed error, got %v", err)
+	}
+	for _, target := range []string{"one", "two"} {
+		evt, err := b.ReadEvent()
+		if err != nil {
+			t.Fatalf("cannot read buffered event %s: %v", target, err)
+		}
+		if evt.GetTarget() != target {
+			t.Fatalf("expected target %s, got %s", target, evt.GetTarget())
+		}
+	}
+	if _, err := b.ReadEvent(); !IsClosed(err) {
+		t.Fatalf("read of drained pipe: expected closed error, got %v", err)
+	}
+	if got := b.RemoteAddr(); got != "pipe:a" {
+		t.Fatalf("expected remote address pipe:a, got %s", got)
+	}
+}
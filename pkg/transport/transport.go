@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"io"
+	"net"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+// ErrClosed is returned by read and write calls on a closed transport
+var ErrClosed = errors.New("transport closed")
+
+// Transport carries events between a client and the proxy
+type Transport interface {
+	// ReadEvent blocks until the next event arrives
+	ReadEvent() (*event.Event, error)
+	// WriteEvent sends an event. It is safe for concurrent use.
+	WriteEvent(evt *event.Event) error
+	// Close closes the transport. Pending reads of both sides return an error.
+	Close() error
+	// RemoteAddr identifies the remote side of the transport
+	RemoteAddr() string
+}
+
+// IsClosed checks whether err results from a regular close of the transport
+func IsClosed(err error) bool {
+	if errors.Is(err, ErrClosed) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) {
+		return true
+	}
+	return websocket.IsCloseError(errors.Cause(err), websocket.CloseNormalClosure, websocket.CloseNoStatusReceived, websocket.CloseAbnormalClosure, websocket.CloseGoingAway)
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/websocket"
+	"github.com/je4/securedisplay/pkg/event"
+)
+
+func NewWebsocket(conn *websocket.Conn) *Websocket {
+	return &Websocket{
+		conn:    conn,
+		writeMu: sync.Mutex{},
+	}
+}
+
+// Websocket transports json encoded events over a websocket connection
+type Websocket struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (ws *Websocket) ReadEvent() (*event.Event, error) {
+	var evt = &event.Event{}
+	if err := ws.conn.ReadJSON(evt); err != nil {
+		return nil, errors.Wrap(err, "cannot read event")
+	}
+	return evt, nil
+}
+
+func (ws *Websocket) WriteEvent(evt *event.Event) error {
+	// websocket connections support only one concurrent writer
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if err := ws.conn.WriteJSON(evt); err != nil {
+		return errors.Wrapf(err, "cannot write event %s", evt)
+	}
+	return nil
+}
+
+// Close sends a close message to the remote side and closes the connection
+func (ws *Websocket) Close() error {
+	deadline := time.Now().Add(5 * time.Second)
+	if err := ws.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		deadline,
+	); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+		ws.conn.Close()
+		return errors.Wrap(err, "cannot send close message")
+	}
+	return errors.WithStack(ws.conn.Close())
+}
+
+func (ws *Websocket) RemoteAddr() string {
+	return ws.conn.RemoteAddr().String()
+}
+
+// Conn returns the underlying websocket connection
+func (ws *Websocket) Conn() *websocket.Conn {
+	return ws.conn
+}
+
+var _ Transport = (*Websocket)(nil)